@@ -0,0 +1,103 @@
+package science
+
+import "sync"
+
+// ExperimentStats summarizes the results an Aggregator has received for one
+// experiment.
+type ExperimentStats struct {
+	Runs         int64         // Results received, whether or not the candidate ran
+	Matches      int64         // Results in which the candidate matched the control
+	Mismatches   int64         // Results in which the candidate did not match, including panics
+	Panics       int64         // Results in which the candidate panicked
+	Skips        int64         // Results in which only the control ran
+	MismatchRate float64       // Mismatches as a fraction of the results that were compared
+	Control      DurationStats // Recent control durations
+	Candidate    DurationStats // Recent candidate durations
+}
+
+// Aggregator rolls up the results of many experiments by name, for an
+// in-process view of how every experiment is doing, such as a debug page. Its
+// Publish method can be used as the Publish function of any number of
+// experiments, or passed to MultiPublish through ContextPublisher.
+type Aggregator struct {
+	window int
+
+	mu          sync.Mutex
+	experiments map[string]*aggregate
+}
+
+// aggregate holds the running totals for one experiment name.
+type aggregate struct {
+	stats     ExperimentStats
+	control   durationRing
+	candidate durationRing
+}
+
+// NewAggregator returns an Aggregator that computes duration percentiles over
+// the most recent window results of each experiment. If window is zero,
+// DefaultPercentileWindow is used.
+func NewAggregator(window int) *Aggregator {
+	if window <= 0 {
+		window = DefaultPercentileWindow
+	}
+	return &Aggregator{
+		window:      window,
+		experiments: make(map[string]*aggregate),
+	}
+}
+
+// Publish adds the result to its experiment's totals. Partial results are
+// ignored, and Warmup results are counted but their durations are not used.
+func (a *Aggregator) Publish(r *Result) {
+	if r.Partial {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	agg, ok := a.experiments[r.Name]
+	if !ok {
+		agg = &aggregate{}
+		a.experiments[r.Name] = agg
+	}
+
+	s := &agg.stats
+	s.Runs++
+	switch {
+	case r.Candidate == nil:
+		s.Skips++
+		return
+	case !r.Compared:
+	case r.Matched:
+		s.Matches++
+	default:
+		s.Mismatches++
+	}
+	if r.Candidate.Panicked {
+		s.Panics++
+	}
+
+	if r.Control != nil && !r.Warmup {
+		agg.control.add(a.window, r.Control.Duration)
+		agg.candidate.add(a.window, r.Candidate.Duration)
+	}
+}
+
+// Snapshot returns the current statistics for every experiment the Aggregator
+// has received results for, keyed by experiment name.
+func (a *Aggregator) Snapshot() map[string]ExperimentStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	snapshot := make(map[string]ExperimentStats, len(a.experiments))
+	for name, agg := range a.experiments {
+		s := agg.stats
+		if compared := s.Matches + s.Mismatches; compared > 0 {
+			s.MismatchRate = float64(s.Mismatches) / float64(compared)
+		}
+		s.Control, s.Candidate = agg.control.stats(), agg.candidate.stats()
+		snapshot[name] = s
+	}
+	return snapshot
+}
@@ -0,0 +1,66 @@
+package science
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAggregator(t *testing.T) {
+	a := NewAggregator(0)
+
+	for _, v := range []int{1, 1, 1, 2} {
+		v := v
+		e := NewExperiment("parse")
+		e.Publish = a.Publish
+		e.Control = func() interface{} { return 1 }
+		e.Candidate = func() interface{} { return v }
+		e.Run()
+	}
+
+	e := NewExperiment("render")
+	e.Publish = a.Publish
+	e.AlwaysPublish = true
+	e.Enabled = func() bool { return false }
+	e.Control = func() interface{} { return 1 }
+	e.Candidate = func() interface{} { return 1 }
+	e.Run()
+
+	a.Publish(&Result{Name: "render", Partial: true})
+
+	snapshot := a.Snapshot()
+	if len(snapshot) != 2 {
+		t.Fatalf("expected 2 experiments, got %d", len(snapshot))
+	}
+
+	parse := snapshot["parse"]
+	if parse.Runs != 4 || parse.Matches != 3 || parse.Mismatches != 1 || parse.MismatchRate != 0.25 {
+		t.Fatalf("unexpected stats for parse: %+v", parse)
+	}
+	if parse.Control.Count != 4 || parse.Candidate.Count != 4 {
+		t.Fatal("expected durations to be recorded for each run")
+	}
+
+	render := snapshot["render"]
+	if render.Runs != 1 || render.Skips != 1 || render.MismatchRate != 0 {
+		t.Fatalf("unexpected stats for render: %+v", render)
+	}
+}
+
+func TestAggregatorPanicsAndWarmup(t *testing.T) {
+	a := NewAggregator(10)
+	a.Publish(&Result{
+		Name:      "test",
+		Compared:  true,
+		Control:   &Observation{Duration: time.Millisecond},
+		Candidate: &Observation{Panicked: true},
+		Warmup:    true,
+	})
+
+	s := a.Snapshot()["test"]
+	if s.Panics != 1 || s.Mismatches != 1 {
+		t.Fatalf("expected a panic to count as a mismatch, got %+v", s)
+	}
+	if s.Control.Count != 0 {
+		t.Fatal("expected warmup durations not to be used")
+	}
+}
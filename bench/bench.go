@@ -0,0 +1,88 @@
+// Package bench runs science experiments as Go benchmarks, so that the
+// performance of a candidate can be compared with its control using
+// go test -bench.
+package bench
+
+import (
+	"testing"
+
+	"github.com/rubyist/science"
+)
+
+// Benchmark benchmarks the experiment's Control and Candidate as the
+// sub-benchmarks "control" and "candidate", each reporting its own ns/op.
+// The branches are first run once and compared with the experiment's
+// Comparator, failing the benchmark if they do not match.
+//
+// The candidate sub-benchmark also reports two custom metrics, which
+// benchstat can track across commits: "speedup", the control's ns/op
+// divided by the candidate's, so 2 means the candidate takes half as long,
+// and "mismatches", the number of the candidate's values that did not match
+// the control's first value. Values are checked on the first, second,
+// fourth, and so on, iterations, with the timer stopped, so that checking
+// them barely affects the timing.
+//
+//	func BenchmarkParse(b *testing.B) {
+//		bench.Benchmark(b, parseExperiment())
+//	}
+func Benchmark(b *testing.B, e *science.Experiment) {
+	if e.Control == nil {
+		b.Fatal(science.ErrNoControl)
+	}
+	if e.Candidate == nil {
+		b.Fatal(science.ErrNoCandidate)
+	}
+
+	comparator := e.Comparator
+	if e.Score != nil {
+		comparator = science.ScoreComparator(e.Score, e.ScoreThreshold)
+	} else if e.ComparatorName != "" {
+		comparator = science.ComparatorByName(e.ComparatorName)
+	} else if comparator == nil {
+		comparator = science.DefaultComparator
+	}
+	if comparator == nil {
+		b.Fatal(science.ErrNoComparator)
+	}
+
+	control := e.Control()
+	if candidate := e.Candidate(); !comparator(control, candidate) {
+		b.Fatalf("experiment %q: candidate %v does not match control %v", e.Name, candidate, control)
+	}
+
+	var controlPerOp float64
+	b.Run("control", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			e.Control()
+		}
+		controlPerOp = perOp(b)
+	})
+	b.Run("candidate", candidate(e.Candidate, comparator, control, controlPerOp))
+}
+
+// candidate returns the candidate sub-benchmark, which checks the candidate's
+// values against control and reports its speedup over controlPerOp.
+func candidate(f science.ExperimentFunc, comparator science.ComparatorFunc, control interface{}, controlPerOp float64) func(*testing.B) {
+	return func(b *testing.B) {
+		mismatches := 0
+		for i := 0; i < b.N; i++ {
+			v := f()
+			if i&(i+1) == 0 {
+				b.StopTimer()
+				if !comparator(control, v) {
+					mismatches++
+				}
+				b.StartTimer()
+			}
+		}
+		if candidatePerOp := perOp(b); controlPerOp > 0 && candidatePerOp > 0 {
+			b.ReportMetric(controlPerOp/candidatePerOp, "speedup")
+		}
+		b.ReportMetric(float64(mismatches), "mismatches")
+	}
+}
+
+// perOp returns the benchmark's time per iteration in nanoseconds.
+func perOp(b *testing.B) float64 {
+	return float64(b.Elapsed().Nanoseconds()) / float64(b.N)
+}
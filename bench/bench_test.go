@@ -0,0 +1,64 @@
+package bench
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/rubyist/science"
+)
+
+func experiment() *science.Experiment {
+	e := science.NewExperiment("itoa")
+	e.Control = func() interface{} { return strconv.Itoa(12345) }
+	e.Candidate = func() interface{} { return strconv.FormatInt(12345, 10) }
+	return e
+}
+
+func BenchmarkExperiment(b *testing.B) {
+	Benchmark(b, experiment())
+}
+
+func TestBenchmarkRunsBothBranches(t *testing.T) {
+	var control, candidate int
+	e := experiment()
+	e.Control = func() interface{} {
+		control++
+		return 1
+	}
+	e.Candidate = func() interface{} {
+		candidate++
+		return 1
+	}
+
+	testing.Benchmark(func(b *testing.B) { Benchmark(b, e) })
+
+	if control <= 1 || candidate <= 1 {
+		t.Fatalf("expected both branches to be benchmarked, ran %d and %d times", control, candidate)
+	}
+}
+
+func TestBenchmarkReportsMetrics(t *testing.T) {
+	calls := 0
+	slow := func() interface{} {
+		calls++
+		time.Sleep(10 * time.Microsecond)
+		if calls%2 == 0 {
+			return 2
+		}
+		return 1
+	}
+
+	res := testing.Benchmark(candidate(slow, science.DeepEqual, 1, 1e9))
+	if speedup := res.Extra["speedup"]; speedup <= 1 {
+		t.Fatalf("expected a candidate faster than 1s/op to report a speedup above 1, got %v", speedup)
+	}
+	if mismatches := res.Extra["mismatches"]; mismatches < 1 {
+		t.Fatalf("expected the alternating candidate's mismatches to be reported, got %v", mismatches)
+	}
+
+	res = testing.Benchmark(candidate(func() interface{} { return 1 }, science.DeepEqual, 1, 0))
+	if _, ok := res.Extra["speedup"]; ok || res.Extra["mismatches"] != 0 {
+		t.Fatalf("expected no speedup without a control time and no mismatches, got %v", res.Extra)
+	}
+}
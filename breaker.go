@@ -0,0 +1,29 @@
+package science
+
+// BreakerTripped reports whether the experiment's breaker has tripped, so
+// that only the control is run. See BreakerThreshold.
+func (e *Experiment) BreakerTripped() bool {
+	return e.breakerTripped()
+}
+
+// ResetBreaker resets the experiment's breaker, so that the candidate runs
+// again.
+func (e *Experiment) ResetBreaker() {
+	e.failures.Store(0)
+}
+
+func (e *Experiment) breakerTripped() bool {
+	return e.BreakerThreshold > 0 && e.failures.Load() >= int64(e.BreakerThreshold)
+}
+
+// recordCandidate updates the breaker with the outcome of a run in which the
+// candidate was observed. The control's behavior never counts against it:
+// it is not called when the control panicked or returned an error, as its
+// value or the last of its Values.
+func (e *Experiment) recordCandidate(ok bool) {
+	if ok {
+		e.failures.Store(0)
+	} else {
+		e.failures.Add(1)
+	}
+}
@@ -0,0 +1,104 @@
+package science
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBreakerTripsOnCandidateFailures(t *testing.T) {
+	ran := 0
+	e := NewExperiment("test")
+	e.BreakerThreshold = 2
+	e.Control = func() interface{} { return 1 }
+	e.Candidate = func() interface{} {
+		ran++
+		if ran == 1 {
+			panic("boom")
+		}
+		return 2
+	}
+
+	for i := 0; i < 4; i++ {
+		if err := e.Run(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if !e.BreakerTripped() {
+		t.Fatal("expected the breaker to trip after a panic and a mismatch")
+	}
+
+	if ran != 2 {
+		t.Fatalf("expected the candidate to stop running once tripped, ran %d times", ran)
+	}
+
+	e.ResetBreaker()
+	e.Run()
+	if ran != 3 {
+		t.Fatal("expected the candidate to run again after a reset")
+	}
+}
+
+func TestBreakerResetsOnSuccess(t *testing.T) {
+	value := 2
+	e := NewExperiment("test")
+	e.BreakerThreshold = 2
+	e.Control = func() interface{} { return 1 }
+	e.Candidate = func() interface{} { return value }
+
+	e.Run()
+	value = 1
+	e.Run()
+	value = 2
+	e.Run()
+
+	if e.BreakerTripped() {
+		t.Fatal("expected a match to reset the failure count")
+	}
+}
+
+func TestBreakerIgnoresControlPanics(t *testing.T) {
+	e := NewExperiment("test")
+	e.BreakerThreshold = 1
+	e.Control = func() interface{} { panic("control broke") }
+	e.Candidate = func() interface{} { return 1 }
+
+	for i := 0; i < 5; i++ {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("expected the control panic to propagate")
+				}
+			}()
+			e.Run()
+		}()
+	}
+
+	if e.BreakerTripped() {
+		t.Fatal("expected control panics not to trip the breaker")
+	}
+}
+
+func TestBreakerIgnoresControlErrors(t *testing.T) {
+	e := NewExperiment("test")
+	e.BreakerThreshold = 1
+	e.Control = func() interface{} { return Values(0, errors.New("database down")) }
+	e.Candidate = func() interface{} { return Values(1, nil) }
+	e.Publish = func(*Result) {}
+
+	for i := 0; i < 5; i++ {
+		e.Run()
+	}
+	if e.BreakerTripped() {
+		t.Fatal("expected control errors not to trip the breaker")
+	}
+
+	e.RecoverControl = true
+	e.Control = func() interface{} { panic("control broke") }
+	for i := 0; i < 5; i++ {
+		e.Run()
+	}
+	if e.BreakerTripped() {
+		t.Fatal("expected recovered control panics not to trip the breaker")
+	}
+}
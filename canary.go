@@ -0,0 +1,125 @@
+package science
+
+import (
+	"math/rand"
+	"sync"
+)
+
+// DefaultCanaryWindow is the number of results a Canary evaluates at a time
+// when NewCanary is given a window of zero.
+const DefaultCanaryWindow = 100
+
+// CanaryState describes what a Canary last did with its percent.
+type CanaryState string
+
+// States of a Canary.
+const (
+	CanaryRamping    CanaryState = "ramping"     // The last window passed, and the percent was increased
+	CanaryBackingOff CanaryState = "backing off" // The last window failed, and the percent was decreased
+	CanaryComplete   CanaryState = "complete"    // The candidate runs on every run
+)
+
+// Canary automates a progressive rollout of a candidate. It enables the
+// candidate on a percentage of runs, starting low, and evaluates the results
+// in windows: each time a window's failure rate, the fraction of compared
+// results that mismatched or in which the candidate panicked, is at or below
+// the threshold, the percent is raised by a step, and each time it is above,
+// the percent is lowered by a step, to no less than where it started.
+//
+// Use its Enabled method as the experiment's Enabled function, and its
+// Publish method as the Publish function, or as one of several given to
+// MultiPublish by way of ContextPublisher.
+// A Canary should drive a single experiment.
+type Canary struct {
+	start     float64
+	step      float64
+	threshold float64
+	window    int
+
+	mu       sync.Mutex
+	percent  float64
+	state    CanaryState
+	results  int // results in the current window
+	failures int // failed results in the current window
+}
+
+// NewCanary returns a Canary that starts the candidate at start percent of
+// runs and moves it by step percent at a time, increasing it while no more
+// than threshold, a fraction between 0 and 1, of each window results fail.
+// If window is zero, DefaultCanaryWindow is used.
+func NewCanary(start, step, threshold float64, window int) *Canary {
+	if window <= 0 {
+		window = DefaultCanaryWindow
+	}
+	c := &Canary{
+		start:     start,
+		step:      step,
+		threshold: threshold,
+		window:    window,
+		percent:   start,
+		state:     CanaryRamping,
+	}
+	if start >= 100 {
+		c.percent = 100
+		c.state = CanaryComplete
+	}
+	return c
+}
+
+// Enabled reports whether the candidate should run, which it does on the
+// canary's current percent of calls. It satisfies EnabledFunc.
+func (c *Canary) Enabled() bool {
+	return rand.Float64()*100 < c.Percent()
+}
+
+// Publish counts the result towards the current window, and moves the
+// percent once the window is full. Results in which the candidate did not
+// run or was not compared, partial results, and Warmup results are ignored.
+func (c *Canary) Publish(r *Result) {
+	if r.Partial || r.Warmup || r.Candidate == nil || !r.Compared {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.results++
+	if !r.Matched {
+		c.failures++
+	}
+	if c.results < c.window {
+		return
+	}
+
+	if float64(c.failures)/float64(c.results) <= c.threshold {
+		c.percent += c.step
+		c.state = CanaryRamping
+		if c.percent >= 100 {
+			c.percent = 100
+			c.state = CanaryComplete
+		}
+	} else {
+		c.percent -= c.step
+		if c.percent < c.start {
+			c.percent = c.start
+		}
+		c.state = CanaryBackingOff
+	}
+	c.results, c.failures = 0, 0
+}
+
+// Percent returns the percentage of runs in which the candidate currently
+// runs.
+func (c *Canary) Percent() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.percent
+}
+
+// State returns what the canary last did with its percent. A new Canary is
+// CanaryRamping, unless it starts at 100 percent.
+func (c *Canary) State() CanaryState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
@@ -0,0 +1,72 @@
+package science
+
+import "testing"
+
+func TestCanary(t *testing.T) {
+	c := NewCanary(10, 30, 0.1, 10)
+	if c.Percent() != 10 || c.State() != CanaryRamping {
+		t.Fatalf("expected to start ramping at 10%%, got %v%% %s", c.Percent(), c.State())
+	}
+
+	window := func(failures int) {
+		for i := 0; i < 10; i++ {
+			c.Publish(&Result{Compared: true, Matched: i >= failures, Candidate: &Observation{}})
+		}
+	}
+
+	window(1)
+	if c.Percent() != 40 || c.State() != CanaryRamping {
+		t.Fatalf("expected a passing window to ramp up to 40%%, got %v%% %s", c.Percent(), c.State())
+	}
+
+	c.Publish(&Result{Control: &Observation{}})
+	c.Publish(&Result{Candidate: &Observation{}})
+	c.Publish(&Result{Compared: true, Partial: true, Candidate: &Observation{}})
+	window(5)
+	if c.Percent() != 10 || c.State() != CanaryBackingOff {
+		t.Fatalf("expected a failing window to back off to 10%%, got %v%% %s", c.Percent(), c.State())
+	}
+
+	window(0)
+	window(0)
+	window(0)
+	if c.Percent() != 100 || c.State() != CanaryComplete {
+		t.Fatalf("expected to complete at 100%%, got %v%% %s", c.Percent(), c.State())
+	}
+	for i := 0; i < 100; i++ {
+		if !c.Enabled() {
+			t.Fatal("expected a complete canary to always enable the candidate")
+		}
+	}
+
+	window(5)
+	window(5)
+	window(5)
+	window(5)
+	if c.Percent() != 10 {
+		t.Fatalf("expected not to back off below the start, got %v%%", c.Percent())
+	}
+}
+
+func TestCanaryEnabled(t *testing.T) {
+	c := NewCanary(0, 10, 0, 0)
+	for i := 0; i < 100; i++ {
+		if c.Enabled() {
+			t.Fatal("expected a canary at 0% never to enable the candidate")
+		}
+	}
+
+	e := NewExperiment("test")
+	e.Enabled = c.Enabled
+	e.Publish = c.Publish
+	e.Control = func() interface{} { return 1 }
+	e.Candidate = func() interface{} { return 1 }
+	e.Run()
+	if s := e.Stats(); s.Skips != 1 {
+		t.Fatalf("expected the run to be skipped, got %+v", s)
+	}
+
+	if NewCanary(100, 10, 0, 0).State() != CanaryComplete {
+		t.Fatal("expected a canary starting at 100% to be complete")
+	}
+}
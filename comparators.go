@@ -0,0 +1,934 @@
+package science
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// compareError is the panic value with which this package's comparators
+// report that they could not compare the values. An experiment records the
+// error in Result.ComparisonErr; any other panic in a comparator propagates.
+type compareError struct {
+	error
+}
+
+// DeepEqual reports whether control and candidate are deeply equal, as
+// reflect.DeepEqual does. Values of the same basic type, such as ints and
+// strings, are compared with == instead, avoiding the cost of
+// reflect.DeepEqual in the common case. It is the initial DefaultComparator.
+func DeepEqual(control, candidate interface{}) bool {
+	ta, tb := reflect.TypeOf(control), reflect.TypeOf(candidate)
+	if ta != nil && ta == tb && basicKind(ta.Kind()) {
+		return control == candidate
+	}
+	return reflect.DeepEqual(control, candidate)
+}
+
+// basicKind reports whether values of kind k are compared by value with ==.
+func basicKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return true
+	}
+	return false
+}
+
+// UnorderedSliceComparator compares two slices as multisets: they match if
+// they contain the same elements the same number of times, regardless of
+// order. Values that are not both slices are compared with reflect.DeepEqual.
+func UnorderedSliceComparator(control, candidate interface{}) bool {
+	a, b := reflect.ValueOf(control), reflect.ValueOf(candidate)
+	if a.Kind() != reflect.Slice || b.Kind() != reflect.Slice || a.Type() != b.Type() {
+		return reflect.DeepEqual(control, candidate)
+	}
+
+	return sameElements(a, b)
+}
+
+// SortedByComparator returns a comparator for slices whose elements may come
+// back in any order but are not comparable as a multiset, such as structs
+// holding slices or maps. Copies of both slices are sorted using less, which
+// is called with two elements, and then compared element by element with
+// reflect.DeepEqual. The slices passed to the comparator are never modified.
+// Values that are not both slices of the same type are compared with
+// reflect.DeepEqual.
+func SortedByComparator(less func(a, b interface{}) bool) ComparatorFunc {
+	return func(control, candidate interface{}) bool {
+		a, b := reflect.ValueOf(control), reflect.ValueOf(candidate)
+		if a.Kind() != reflect.Slice || b.Kind() != reflect.Slice || a.Type() != b.Type() {
+			return reflect.DeepEqual(control, candidate)
+		}
+		if a.Len() != b.Len() {
+			return false
+		}
+
+		sa, sb := sortedCopy(a, less), sortedCopy(b, less)
+		for i := 0; i < sa.Len(); i++ {
+			if !reflect.DeepEqual(sa.Index(i).Interface(), sb.Index(i).Interface()) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// sortedCopy returns a copy of the slice v sorted using less.
+func sortedCopy(v reflect.Value, less func(a, b interface{}) bool) reflect.Value {
+	c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+	reflect.Copy(c, v)
+	sort.SliceStable(c.Interface(), func(i, j int) bool {
+		return less(c.Index(i).Interface(), c.Index(j).Interface())
+	})
+	return c
+}
+
+// ErrorComparator compares errors using errors.Is semantics. Two nil errors
+// match, and two non-nil errors match if either one wraps the other or both
+// wrap a common error, such as the same sentinel. Both single wrapping, with
+// Unwrap() error, and multiple wrapping, with Unwrap() []error as returned by
+// errors.Join, are followed. Values that are not both errors are compared
+// with reflect.DeepEqual.
+//
+// Errors are not matched by type, as errors.As would: every error made with
+// errors.New or fmt.Errorf shares a type, so a mismatching cause would go
+// unnoticed. To treat errors of one type as equivalent, compare them with a
+// TransformComparator that maps each error to what should be compared.
+func ErrorComparator(control, candidate interface{}) bool {
+	if control == nil && candidate == nil {
+		return true
+	}
+
+	a, ok1 := control.(error)
+	b, ok2 := candidate.(error)
+	if !ok1 || !ok2 {
+		return reflect.DeepEqual(control, candidate)
+	}
+
+	return wrapsCommon(a, b) || errors.Is(a, b)
+}
+
+// wrapsCommon reports whether b is, or wraps, err or any error err wraps.
+func wrapsCommon(err, b error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(b, err) {
+		return true
+	}
+	switch u := err.(type) {
+	case interface{ Unwrap() error }:
+		return wrapsCommon(u.Unwrap(), b)
+	case interface{ Unwrap() []error }:
+		for _, err := range u.Unwrap() {
+			if wrapsCommon(err, b) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sameError reports whether both observations returned equal non-nil
+// errors, as ErrorComparator compares them. An observation's error is its
+// value if that is an error, or the last of its Values.
+func sameError(control, candidate *Observation) bool {
+	if control.Panicked || candidate.Panicked {
+		return false
+	}
+	a, b := valueError(control.Value), valueError(candidate.Value)
+	return a != nil && b != nil && ErrorComparator(a, b)
+}
+
+func valueError(v interface{}) error {
+	if list, ok := v.(valueList); ok && len(list) > 0 {
+		v = list[len(list)-1]
+	}
+	err, _ := v.(error)
+	return err
+}
+
+// valueList holds the results of a branch that returns several values.
+type valueList []interface{}
+
+// Values bundles several return values into a single value, for experiments
+// on functions with multiple results:
+//
+//	e.Control = func() interface{} {
+//		n, err := oldParse(s)
+//		return science.Values(n, err)
+//	}
+//
+// Use ValuesComparator to compare them.
+func Values(v ...interface{}) interface{} {
+	return valueList(v)
+}
+
+// ValuesComparator compares values created with Values element by element
+// using reflect.DeepEqual. Lists of different lengths never match. Any other
+// values are compared with reflect.DeepEqual.
+func ValuesComparator(control, candidate interface{}) bool {
+	a, ok1 := control.(valueList)
+	b, ok2 := candidate.(valueList)
+	if !ok1 || !ok2 {
+		return reflect.DeepEqual(control, candidate)
+	}
+
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !reflect.DeepEqual(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameElements reports whether the slices a and b hold the same elements,
+// ignoring order. Elements whose == agrees with reflect.DeepEqual are counted
+// in a map; anything else falls back to pairing elements off with
+// reflect.DeepEqual.
+func sameElements(a, b reflect.Value) bool {
+	if a.Len() != b.Len() {
+		return false
+	}
+
+	if hashable(a.Type().Elem()) {
+		counts := make(map[interface{}]int, a.Len())
+		for i := 0; i < a.Len(); i++ {
+			counts[a.Index(i).Interface()]++
+		}
+		for i := 0; i < b.Len(); i++ {
+			v := b.Index(i).Interface()
+			if counts[v] == 0 {
+				return false
+			}
+			counts[v]--
+		}
+		return true
+	}
+
+	used := make([]bool, b.Len())
+	for i := 0; i < a.Len(); i++ {
+		found := false
+		for j := 0; j < b.Len(); j++ {
+			if !used[j] && reflect.DeepEqual(a.Index(i).Interface(), b.Index(j).Interface()) {
+				used[j] = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// hashable reports whether values of type t can always be used as map keys,
+// with keys equal exactly when reflect.DeepEqual finds them so. Interfaces
+// are excluded, as the dynamic value they hold might not be comparable, and
+// so are pointers and channels, which == compares by identity.
+func hashable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Interface, reflect.Ptr, reflect.Chan, reflect.UnsafePointer:
+		return false
+	case reflect.Array:
+		return hashable(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if !hashable(t.Field(i).Type) {
+				return false
+			}
+		}
+		return true
+	}
+	return t.Comparable()
+}
+
+// FuncComparator returns a ComparatorFunc for branches that return functions.
+// The functions must be of the same type and take a single argument. Each is
+// called with every probe and they match if their results are
+// reflect.DeepEqual for all of them. Probes that cannot be passed to the
+// functions cause a mismatch. Values that are not both functions are compared
+// with reflect.DeepEqual.
+func FuncComparator(probes []interface{}) ComparatorFunc {
+	return func(control, candidate interface{}) bool {
+		a, b := reflect.ValueOf(control), reflect.ValueOf(candidate)
+		if a.Kind() != reflect.Func || b.Kind() != reflect.Func {
+			return reflect.DeepEqual(control, candidate)
+		}
+
+		t := a.Type()
+		if t != b.Type() || t.NumIn() != 1 || t.IsVariadic() || a.IsNil() || b.IsNil() {
+			return false
+		}
+
+		for _, probe := range probes {
+			arg := reflect.ValueOf(probe)
+			if probe == nil {
+				arg = reflect.Zero(t.In(0))
+			}
+			if !arg.Type().AssignableTo(t.In(0)) {
+				return false
+			}
+
+			in := []reflect.Value{arg}
+			if !reflect.DeepEqual(results(a.Call(in)), results(b.Call(in))) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func results(out []reflect.Value) []interface{} {
+	vals := make([]interface{}, len(out))
+	for i, v := range out {
+		vals[i] = v.Interface()
+	}
+	return vals
+}
+
+// FieldsComparator returns a ComparatorFunc that compares structs, or
+// pointers to structs, on the named exported fields only, using
+// reflect.DeepEqual. Structs of different types, or without one of the
+// fields, do not match. A field promoted through an embedded pointer that is
+// nil in both structs matches, and one nil in only one of them does not.
+// Values that are not structs are compared with reflect.DeepEqual.
+func FieldsComparator(fieldNames ...string) ComparatorFunc {
+	return func(control, candidate interface{}) bool {
+		a, b := indirect(reflect.ValueOf(control)), indirect(reflect.ValueOf(candidate))
+		if a.Kind() != reflect.Struct || b.Kind() != reflect.Struct {
+			return reflect.DeepEqual(control, candidate)
+		}
+		if a.Type() != b.Type() {
+			return false
+		}
+
+		for _, name := range fieldNames {
+			f, ok := a.Type().FieldByName(name)
+			if !ok || !f.IsExported() {
+				return false
+			}
+			x, errA := a.FieldByIndexErr(f.Index)
+			y, errB := b.FieldByIndexErr(f.Index)
+			if errA != nil || errB != nil {
+				if errA == nil || errB == nil {
+					return false
+				}
+				continue
+			}
+			if !reflect.DeepEqual(x.Interface(), y.Interface()) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// StructComparator returns a ComparatorFunc that compares structs, or
+// pointers to structs, field by field, using the comparator in fields for
+// each exported field it names, and reflect.DeepEqual for the rest. A field
+// whose comparator is nil is ignored. Unexported fields are compared with
+// reflect.DeepEqual. Structs of different types do not match.
+//
+// Values that are not structs, and fields that names a struct does not have
+// as exported fields, are errors, which the experiment records as its
+// Result's ComparisonErr. Called directly rather than by an experiment, the
+// comparator panics instead.
+func StructComparator(fields map[string]ComparatorFunc) ComparatorFunc {
+	return func(control, candidate interface{}) bool {
+		a, b := indirect(reflect.ValueOf(control)), indirect(reflect.ValueOf(candidate))
+		if a.Kind() != reflect.Struct || b.Kind() != reflect.Struct {
+			panic(compareError{fmt.Errorf("science: StructComparator given %T and %T, not structs", control, candidate)})
+		}
+		if a.Type() != b.Type() {
+			return false
+		}
+
+		t := a.Type()
+		for name := range fields {
+			if f, ok := t.FieldByName(name); !ok || !f.IsExported() || len(f.Index) != 1 {
+				panic(compareError{fmt.Errorf("science: StructComparator: %v has no exported field %s", t, name)})
+			}
+		}
+
+		// Copies with the exported fields zeroed compare the unexported ones.
+		ua, ub := reflect.New(t).Elem(), reflect.New(t).Elem()
+		ua.Set(a)
+		ub.Set(b)
+		for i := 0; i < t.NumField(); i++ {
+			if !t.Field(i).IsExported() {
+				continue
+			}
+			x, y := a.Field(i).Interface(), b.Field(i).Interface()
+			cmp, ok := fields[t.Field(i).Name]
+			switch {
+			case !ok:
+				if !reflect.DeepEqual(x, y) {
+					return false
+				}
+			case cmp != nil:
+				if !cmp(x, y) {
+					return false
+				}
+			}
+			ua.Field(i).Set(reflect.Zero(t.Field(i).Type))
+			ub.Field(i).Set(reflect.Zero(t.Field(i).Type))
+		}
+		return reflect.DeepEqual(ua.Interface(), ub.Interface())
+	}
+}
+
+// indirect follows v through any non-nil pointers.
+func indirect(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	return v
+}
+
+// TransformComparator returns a ComparatorFunc that applies transform to both
+// values and compares the results with inner, or with reflect.DeepEqual if
+// inner is nil. For example, to compare strings case-insensitively:
+//
+//	science.TransformComparator(func(v interface{}) interface{} {
+//		return strings.ToLower(v.(string))
+//	}, nil)
+func TransformComparator(transform func(interface{}) interface{}, inner ComparatorFunc) ComparatorFunc {
+	if inner == nil {
+		inner = reflect.DeepEqual
+	}
+	return func(control, candidate interface{}) bool {
+		return inner(transform(control), transform(candidate))
+	}
+}
+
+// NilEmptyEquivalentComparator returns a ComparatorFunc that treats nil and
+// empty slices and maps as equal, and compares the values with inner, or with
+// reflect.DeepEqual if inner is nil. It applies at any depth: to slice and
+// array elements, map values, exported struct fields, and values behind
+// pointers and interfaces. Unexported struct fields are compared as they are.
+// The values passed to the comparator are not modified.
+func NilEmptyEquivalentComparator(inner ComparatorFunc) ComparatorFunc {
+	return TransformComparator(func(v interface{}) interface{} {
+		return rewrite(v, func(v reflect.Value) (reflect.Value, bool) {
+			if (v.Kind() == reflect.Slice || v.Kind() == reflect.Map) && v.Len() == 0 {
+				return reflect.Zero(v.Type()), true
+			}
+			return v, false
+		})
+	}, inner)
+}
+
+// RoundTimesComparator returns a ComparatorFunc that rounds every time.Time
+// to the nearest multiple of granularity, and compares the values with
+// inner, or with reflect.DeepEqual if inner is nil. Like
+// NilEmptyEquivalentComparator it applies at any depth, through exported
+// struct fields, slices, arrays, maps, pointers and interfaces, and does not
+// modify the values passed to the comparator. Rounding also drops any
+// monotonic clock reading, so a granularity of zero or less compares times
+// by their wall clock alone.
+func RoundTimesComparator(granularity time.Duration, inner ComparatorFunc) ComparatorFunc {
+	return TransformComparator(func(v interface{}) interface{} {
+		return rewrite(v, func(v reflect.Value) (reflect.Value, bool) {
+			if v.Type() == timeType {
+				return reflect.ValueOf(v.Interface().(time.Time).Round(granularity)), true
+			}
+			return v, false
+		})
+	}, inner)
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// rewrite returns a copy of v in which every value for which replace returns
+// true, at any depth, is swapped for the value it returns.
+func rewrite(v interface{}, replace func(reflect.Value) (reflect.Value, bool)) interface{} {
+	if v == nil {
+		return nil
+	}
+	return rewriteValue(reflect.ValueOf(v), replace, map[seenPointer]reflect.Value{}).Interface()
+}
+
+// seenPointer identifies a pointer rewriteValue has already copied. The type
+// is part of the key because a struct and its first field, or any two
+// zero-size values, can share an address.
+type seenPointer struct {
+	addr uintptr
+	typ  reflect.Type
+}
+
+// rewriteValue is rewrite for a reflect.Value. Pointers already copied are
+// recorded in seen, so that cyclic values are copied only once.
+func rewriteValue(v reflect.Value, replace func(reflect.Value) (reflect.Value, bool), seen map[seenPointer]reflect.Value) reflect.Value {
+	if r, ok := replace(v); ok {
+		return r
+	}
+
+	switch v.Kind() {
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(rewriteValue(v.Index(i), replace, seen))
+		}
+		return c
+	case reflect.Array:
+		c := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(rewriteValue(v.Index(i), replace, seen))
+		}
+		return c
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			c.SetMapIndex(iter.Key(), rewriteValue(iter.Value(), replace, seen))
+		}
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for i := 0; i < c.NumField(); i++ {
+			if f := c.Field(i); f.CanSet() {
+				f.Set(rewriteValue(v.Field(i), replace, seen))
+			}
+		}
+		return c
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		key := seenPointer{v.Pointer(), v.Type()}
+		if c, ok := seen[key]; ok {
+			return c
+		}
+		c := reflect.New(v.Type().Elem())
+		seen[key] = c
+		c.Elem().Set(rewriteValue(v.Elem(), replace, seen))
+		return c
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(rewriteValue(v.Elem(), replace, seen))
+		return c
+	}
+	return v
+}
+
+// DeepEqualOr returns a ComparatorFunc that tries reflect.DeepEqual first,
+// and calls inner only for values it finds unequal, so that matching values
+// cost a single reflect.DeepEqual even when inner is expensive, such as
+// JSONCanonicalComparator or a comparison built on go-cmp. If inner is nil,
+// the values are compared with reflect.DeepEqual alone. Values that
+// reflect.DeepEqual finds equal match without inner being called, so inner
+// must not be stricter than reflect.DeepEqual.
+func DeepEqualOr(inner ComparatorFunc) ComparatorFunc {
+	if inner == nil {
+		return reflect.DeepEqual
+	}
+	return func(control, candidate interface{}) bool {
+		return reflect.DeepEqual(control, candidate) || inner(control, candidate)
+	}
+}
+
+// ScoreComparator returns a ComparatorFunc that matches values whose score,
+// a similarity from 0 to 1, is at least threshold. To record the score on
+// each Result as well, set the experiment's Score and ScoreThreshold
+// instead, which compare the values the same way.
+func ScoreComparator(score ScoreFunc, threshold float64) ComparatorFunc {
+	return func(control, candidate interface{}) bool {
+		return score(control, candidate) >= threshold
+	}
+}
+
+// NumericComparator returns a ComparatorFunc that compares numbers of any
+// integer or floating point type by value, so that int(3) and float64(3)
+// match, along with any two numbers no more than tolerance apart.
+//
+// The comparison itself is exact, but float64 cannot represent every integer
+// with a magnitude over 2^53; a candidate that computes a large int64 as a
+// float64 may already have lost precision, and will mismatch the control
+// unless tolerance allows for it. NaN never matches. Values that are not both
+// numbers are compared with reflect.DeepEqual.
+func NumericComparator(tolerance float64) ComparatorFunc {
+	return func(control, candidate interface{}) bool {
+		a, ok1 := number(control)
+		b, ok2 := number(candidate)
+		if !ok1 || !ok2 {
+			return reflect.DeepEqual(control, candidate)
+		}
+
+		if a == nil || b == nil {
+			return false
+		}
+		if a.IsInf() || b.IsInf() {
+			return a.Cmp(b) == 0
+		}
+
+		diff := new(big.Float).SetPrec(2048).Sub(a, b)
+		return diff.Abs(diff).Cmp(big.NewFloat(tolerance)) <= 0
+	}
+}
+
+// MatrixComparator returns a ComparatorFunc for floating point slices and
+// matrices, such as []float64 or [][]float64, that compares them element by
+// element, matching elements no more than epsilon apart. Nested slices and
+// arrays are compared recursively, and values of different shapes, such as
+// rows of different lengths, do not match. NaN never matches. Values that
+// are not slices, arrays, or floating point numbers are compared with
+// reflect.DeepEqual.
+func MatrixComparator(epsilon float64) ComparatorFunc {
+	return func(control, candidate interface{}) bool {
+		return floatsClose(reflect.ValueOf(control), reflect.ValueOf(candidate), epsilon, false)
+	}
+}
+
+// MapFloatComparator returns a ComparatorFunc for maps of floating point
+// values, such as map[string]float64 feature vectors, that matches maps with
+// the same keys whose values are no more than epsilon apart. A key present
+// in only one map is a mismatch, though a nil map matches an empty one.
+// Maps nested in the values are compared the same way, as are slices and
+// arrays, as MatrixComparator compares them. NaN never matches. Other values
+// are compared with reflect.DeepEqual.
+func MapFloatComparator(epsilon float64) ComparatorFunc {
+	return func(control, candidate interface{}) bool {
+		return floatsClose(reflect.ValueOf(control), reflect.ValueOf(candidate), epsilon, true)
+	}
+}
+
+// floatsClose reports whether a and b are floats, or lists of them, no more
+// than epsilon apart. If maps is set, maps are compared key by key as well.
+func floatsClose(a, b reflect.Value, epsilon float64, maps bool) bool {
+	if a.Kind() == reflect.Interface && !a.IsNil() {
+		a = a.Elem()
+	}
+	if b.Kind() == reflect.Interface && !b.IsNil() {
+		b = b.Elem()
+	}
+
+	switch {
+	case isFloat(a) && isFloat(b):
+		x, y := a.Float(), b.Float()
+		return x == y || math.Abs(x-y) <= epsilon
+	case isList(a) && isList(b):
+		if a.Len() != b.Len() {
+			return false
+		}
+		for i := 0; i < a.Len(); i++ {
+			if !floatsClose(a.Index(i), b.Index(i), epsilon, maps) {
+				return false
+			}
+		}
+		return true
+	case maps && a.Kind() == reflect.Map && b.Kind() == reflect.Map:
+		if a.Len() != b.Len() || a.Type().Key() != b.Type().Key() {
+			return false
+		}
+		iter := a.MapRange()
+		for iter.Next() {
+			v := b.MapIndex(iter.Key())
+			if !v.IsValid() || !floatsClose(iter.Value(), v, epsilon, maps) {
+				return false
+			}
+		}
+		return true
+	case maps && (a.Kind() == reflect.Map || b.Kind() == reflect.Map):
+		return false
+	case isList(a) || isList(b) || isFloat(a) || isFloat(b):
+		return false
+	case !a.IsValid() || !b.IsValid():
+		return a.IsValid() == b.IsValid()
+	}
+	return reflect.DeepEqual(a.Interface(), b.Interface())
+}
+
+func isFloat(v reflect.Value) bool {
+	return v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64
+}
+
+func isList(v reflect.Value) bool {
+	return v.Kind() == reflect.Slice || v.Kind() == reflect.Array
+}
+
+// BigComparator compares *big.Int, *big.Rat, and *big.Float values by their
+// numeric value using Cmp, rather than by their internal representation as
+// reflect.DeepEqual does, so that, for example, an unnormalized big.Rat
+// matches its normalized form. Values of different big types are compared
+// exactly, so big.NewInt(2) matches big.NewRat(4, 2). An infinite big.Float
+// matches only an infinity of the same sign, and two nil pointers match only
+// each other. Values that are not both big numbers are compared with
+// reflect.DeepEqual.
+func BigComparator(control, candidate interface{}) bool {
+	switch a := control.(type) {
+	case *big.Int:
+		if b, ok := candidate.(*big.Int); ok && a != nil && b != nil {
+			return a.Cmp(b) == 0
+		}
+	case *big.Float:
+		if b, ok := candidate.(*big.Float); ok && a != nil && b != nil {
+			return a.Cmp(b) == 0
+		}
+	}
+
+	a, infA, ok1 := bigRat(control)
+	b, infB, ok2 := bigRat(candidate)
+	if !ok1 || !ok2 {
+		return reflect.DeepEqual(control, candidate)
+	}
+	if infA != 0 || infB != 0 {
+		return infA == infB
+	}
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Cmp(b) == 0
+}
+
+// Comparable is implemented by domain types, such as money, that define
+// their own equality. CmpTo returns a negative number, zero, or a positive
+// number as the value is less than, equal to, or greater than other.
+type Comparable interface {
+	CmpTo(other interface{}) int
+}
+
+// ComparableComparator compares values that both implement Comparable with
+// the control's CmpTo method, matching when it returns zero. Other values
+// are compared with BigComparator, so math/big values are also compared by
+// value.
+func ComparableComparator(control, candidate interface{}) bool {
+	a, ok1 := control.(Comparable)
+	_, ok2 := candidate.(Comparable)
+	if !ok1 || !ok2 {
+		return BigComparator(control, candidate)
+	}
+	return a.CmpTo(candidate) == 0
+}
+
+// bigRat converts a big number to an exact big.Rat. Nil pointers are reported
+// as big numbers, but with a nil value, and so are infinite big.Floats, whose
+// sign is returned as inf, 1 or -1; inf is 0 for every other value.
+func bigRat(v interface{}) (r *big.Rat, inf int, ok bool) {
+	switch n := v.(type) {
+	case *big.Int:
+		if n == nil {
+			return nil, 0, true
+		}
+		return new(big.Rat).SetInt(n), 0, true
+	case *big.Rat:
+		return n, 0, true
+	case *big.Float:
+		if n == nil {
+			return nil, 0, true
+		}
+		if n.IsInf() {
+			return nil, n.Sign(), true
+		}
+		r, _ := n.Rat(nil)
+		return r, 0, true
+	}
+	return nil, 0, false
+}
+
+// number converts v to an exact big.Float if it is an integer or floating
+// point number. A NaN is reported as a number, but with a nil value.
+func number(v interface{}) (*big.Float, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return new(big.Float).SetInt64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return new(big.Float).SetUint64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if math.IsNaN(f) {
+			return nil, true
+		}
+		return new(big.Float).SetFloat64(f), true
+	}
+	return nil, false
+}
+
+// IgnoreMapKeysComparator returns a ComparatorFunc that compares maps with
+// string keys using reflect.DeepEqual after removing the given keys from
+// copies of both; the original maps are not modified. Maps of different
+// types, and other values, are compared with reflect.DeepEqual.
+func IgnoreMapKeysComparator(keys ...string) ComparatorFunc {
+	return func(control, candidate interface{}) bool {
+		a, b := reflect.ValueOf(control), reflect.ValueOf(candidate)
+		if a.Kind() != reflect.Map || b.Kind() != reflect.Map || a.Type() != b.Type() || a.Type().Key().Kind() != reflect.String {
+			return reflect.DeepEqual(control, candidate)
+		}
+
+		return reflect.DeepEqual(withoutKeys(a, keys), withoutKeys(b, keys))
+	}
+}
+
+// withoutKeys returns a copy of the map m without the given keys.
+func withoutKeys(m reflect.Value, keys []string) interface{} {
+	if m.IsNil() {
+		return m.Interface()
+	}
+
+	c := reflect.MakeMapWithSize(m.Type(), m.Len())
+	iter := m.MapRange()
+	for iter.Next() {
+		c.SetMapIndex(iter.Key(), iter.Value())
+	}
+	for _, k := range keys {
+		c.SetMapIndex(reflect.ValueOf(k).Convert(m.Type().Key()), reflect.Value{})
+	}
+	return c.Interface()
+}
+
+// ChannelComparator returns a ComparatorFunc for branches that return
+// channels. It receives from both channels until they are closed, or until
+// limit values have been received from each, and compares the values in the
+// order they were received with reflect.DeepEqual. Channels that yield
+// different numbers of values do not match.
+//
+// Draining consumes the channels, including the control's, which is the
+// value returned to the caller: with the candidate running, the caller
+// receives a channel that has already been drained, and sees none of the
+// values the comparator took from it. Unlike a reader, a channel cannot be
+// rewound, so this comparator only suits branches whose channels nobody else
+// reads. Otherwise have the branches collect what they produce and return a
+// slice, and compare that with UnorderedSliceComparator or
+// reflect.DeepEqual.
+//
+// Draining blocks until each channel is closed or has yielded limit values,
+// so the producers must eventually do one or the other. Values that are not
+// both channels are compared with reflect.DeepEqual.
+func ChannelComparator(limit int) ComparatorFunc {
+	return channelComparator(limit, false)
+}
+
+// UnorderedChannelComparator is like ChannelComparator, but compares the values
+// received as multisets, as UnorderedSliceComparator does, for channels fed
+// by concurrent producers whose order is not deterministic. It drains the
+// control's channel before the caller receives it, just as ChannelComparator
+// does.
+func UnorderedChannelComparator(limit int) ComparatorFunc {
+	return channelComparator(limit, true)
+}
+
+func channelComparator(limit int, unordered bool) ComparatorFunc {
+	return func(control, candidate interface{}) bool {
+		a, b := reflect.ValueOf(control), reflect.ValueOf(candidate)
+		if a.Kind() != reflect.Chan || b.Kind() != reflect.Chan {
+			return reflect.DeepEqual(control, candidate)
+		}
+
+		va, vb := drain(a, limit), drain(b, limit)
+		if unordered {
+			return sameElements(reflect.ValueOf(va), reflect.ValueOf(vb))
+		}
+		return reflect.DeepEqual(va, vb)
+	}
+}
+
+// drain receives up to limit values from the channel c, stopping early if it
+// is closed.
+func drain(c reflect.Value, limit int) []interface{} {
+	vals := []interface{}{}
+	if c.IsNil() {
+		return vals
+	}
+	for len(vals) < limit {
+		v, ok := c.Recv()
+		if !ok {
+			break
+		}
+		vals = append(vals, v.Interface())
+	}
+	return vals
+}
+
+// JSONCanonicalComparator compares values by their JSON representation: both
+// are marshaled to JSON and unmarshaled into generic values, which are then
+// compared with reflect.DeepEqual. This ignores differences that do not
+// survive the round trip, such as struct versus map, pointer versus value, or
+// the type of a number, so values match if they are the same on the wire.
+//
+// If either value cannot be marshaled, Run records the error in
+// Result.ComparisonErr. Called directly rather than by an experiment, the
+// comparator panics instead.
+func JSONCanonicalComparator(control, candidate interface{}) bool {
+	return reflect.DeepEqual(canonicalJSON(control), canonicalJSON(candidate))
+}
+
+func canonicalJSON(v interface{}) interface{} {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(compareError{fmt.Errorf("science: JSON comparison: %w", err)})
+	}
+
+	var canonical interface{}
+	if err := json.Unmarshal(b, &canonical); err != nil {
+		panic(compareError{fmt.Errorf("science: JSON comparison: %w", err)})
+	}
+	return canonical
+}
+
+// ReaderComparator returns a ComparatorFunc for branches that return
+// io.Readers. It reads both readers to the end and compares their contents
+// with bytes.Equal. Readers that yield more than limit bytes are not read
+// further, and Run records an error in Result.ComparisonErr, as it does if
+// either reader fails. Called directly rather than by an experiment, the
+// comparator panics instead.
+//
+// Reading consumes the readers, including the control's, which is the value
+// returned to the caller. Readers that implement io.Seeker, such as
+// *bytes.Reader and *os.File, are rewound to where they were afterwards, so
+// the caller can read them again. Otherwise the branches should return a
+// re-readable source, or buffer their output and return that. Values that
+// are not both readers are compared with reflect.DeepEqual.
+func ReaderComparator(limit int64) ComparatorFunc {
+	return func(control, candidate interface{}) bool {
+		a, ok1 := control.(io.Reader)
+		b, ok2 := candidate.(io.Reader)
+		if !ok1 || !ok2 {
+			return reflect.DeepEqual(control, candidate)
+		}
+
+		return bytes.Equal(readAll(a, limit), readAll(b, limit))
+	}
+}
+
+// readAll reads r to the end, rewinding it afterwards if it can be.
+func readAll(r io.Reader, limit int64) []byte {
+	if s, ok := r.(io.Seeker); ok {
+		if offset, err := s.Seek(0, io.SeekCurrent); err == nil {
+			defer s.Seek(offset, io.SeekStart)
+		}
+	}
+
+	b, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		panic(compareError{fmt.Errorf("science: reading %T: %w", r, err)})
+	}
+	if int64(len(b)) > limit {
+		panic(compareError{fmt.Errorf("science: %T is longer than the %d byte limit", r, limit)})
+	}
+	return b
+}
@@ -0,0 +1,820 @@
+package science
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUnorderedSliceComparator(t *testing.T) {
+	if !UnorderedSliceComparator([]int{1, 2, 2, 3}, []int{3, 2, 1, 2}) {
+		t.Fatal("expected reordered slices to match")
+	}
+
+	if UnorderedSliceComparator([]int{1, 2, 2}, []int{1, 1, 2}) {
+		t.Fatal("expected slices with different counts to mismatch")
+	}
+
+	if UnorderedSliceComparator([]int{1, 2}, []int{1, 2, 3}) {
+		t.Fatal("expected slices of different lengths to mismatch")
+	}
+
+	a := [][]int{{1}, {2, 3}}
+	b := [][]int{{2, 3}, {1}}
+	if !UnorderedSliceComparator(a, b) {
+		t.Fatal("expected reordered slices of non-comparable elements to match")
+	}
+
+	if !UnorderedSliceComparator([]interface{}{[]int{1}, 2}, []interface{}{2, []int{1}}) {
+		t.Fatal("expected reordered interface slices to match")
+	}
+
+	type item struct{ N int }
+	type ref struct{ P *item }
+	if !UnorderedSliceComparator([]*item{{1}, {2}}, []*item{{2}, {1}}) {
+		t.Fatal("expected pointers to equal values to match")
+	}
+	if !UnorderedSliceComparator([]ref{{&item{1}}, {&item{2}}}, []ref{{&item{2}}, {&item{1}}}) {
+		t.Fatal("expected structs holding pointers to equal values to match")
+	}
+	if UnorderedSliceComparator([]*item{{1}, {1}}, []*item{{1}, {2}}) {
+		t.Fatal("expected pointers to different values to mismatch")
+	}
+
+	if !UnorderedSliceComparator(42, 42) || UnorderedSliceComparator(42, 43) {
+		t.Fatal("expected non-slices to be compared with DeepEqual")
+	}
+}
+
+func TestSortedByComparator(t *testing.T) {
+	type record struct {
+		ID   int
+		Tags []string
+	}
+	byID := SortedByComparator(func(a, b interface{}) bool {
+		return a.(record).ID < b.(record).ID
+	})
+
+	control := []record{{1, []string{"a"}}, {2, []string{"b", "c"}}}
+	candidate := []record{{2, []string{"b", "c"}}, {1, []string{"a"}}}
+	if !byID(control, candidate) {
+		t.Fatal("expected reordered records to match")
+	}
+
+	if candidate[0].ID != 2 || control[0].ID != 1 {
+		t.Fatal("expected the original slices not to be sorted")
+	}
+
+	if byID(control, []record{{2, []string{"b"}}, {1, []string{"a"}}}) {
+		t.Fatal("expected records with different fields to mismatch")
+	}
+
+	if byID(control, control[:1]) {
+		t.Fatal("expected slices of different lengths to mismatch")
+	}
+
+	if !byID(42, 42) || byID(42, 43) {
+		t.Fatal("expected non-slices to be compared with DeepEqual")
+	}
+}
+
+func TestValuesComparator(t *testing.T) {
+	err := errors.New("bad input")
+
+	if !ValuesComparator(Values(1, "a", err), Values(1, "a", err)) {
+		t.Fatal("expected identical values to match")
+	}
+
+	if ValuesComparator(Values(1, "a", nil), Values(1, "a", err)) {
+		t.Fatal("expected differing errors to mismatch")
+	}
+
+	if ValuesComparator(Values(1, "a"), Values(1, "a", nil)) {
+		t.Fatal("expected different numbers of values to mismatch")
+	}
+
+	if ValuesComparator(Values(1), 1) {
+		t.Fatal("expected Values not to match a bare value")
+	}
+}
+
+func TestErrorComparator(t *testing.T) {
+	sentinel := errors.New("not found")
+
+	if !ErrorComparator(nil, nil) {
+		t.Fatal("expected nil errors to match")
+	}
+
+	if ErrorComparator(nil, sentinel) || ErrorComparator(sentinel, nil) {
+		t.Fatal("expected nil and non-nil errors to mismatch")
+	}
+
+	a := fmt.Errorf("lookup user: %w", sentinel)
+	b := fmt.Errorf("find user 42: %w", sentinel)
+	if !ErrorComparator(a, b) {
+		t.Fatal("expected errors wrapping the same sentinel to match")
+	}
+
+	if !ErrorComparator(sentinel, b) || !ErrorComparator(a, sentinel) {
+		t.Fatal("expected an error to match an error wrapping it")
+	}
+
+	if ErrorComparator(a, fmt.Errorf("lookup user: %w", errors.New("not found"))) {
+		t.Fatal("expected errors wrapping different sentinels to mismatch")
+	}
+
+	other := errors.New("timeout")
+	joined := errors.Join(other, fmt.Errorf("retry: %w", sentinel))
+	if !ErrorComparator(joined, b) || !ErrorComparator(b, joined) || !ErrorComparator(joined, errors.Join(sentinel)) {
+		t.Fatal("expected errors joined with errors.Join to be followed")
+	}
+	if ErrorComparator(joined, errors.New("timeout")) {
+		t.Fatal("expected joined errors with different causes to mismatch")
+	}
+}
+
+func TestFuncComparator(t *testing.T) {
+	cmp := FuncComparator([]interface{}{0, 1, 2, 10})
+
+	double := func(n int) int { return n * 2 }
+	add := func(n int) int { return n + n }
+	square := func(n int) int { return n * n }
+
+	if !cmp(double, add) {
+		t.Fatal("expected functions that behave the same to match")
+	}
+
+	if cmp(double, square) {
+		t.Fatal("expected functions that behave differently to mismatch")
+	}
+
+	if cmp(double, func(s string) int { return 0 }) {
+		t.Fatal("expected functions of different types to mismatch")
+	}
+
+	if FuncComparator([]interface{}{"x"})(double, add) {
+		t.Fatal("expected probes of the wrong type to mismatch")
+	}
+}
+
+func TestFieldsComparator(t *testing.T) {
+	type user struct {
+		ID        int
+		Name      string
+		CreatedAt int64
+	}
+
+	cmp := FieldsComparator("Name")
+
+	if !cmp(user{1, "ann", 100}, user{2, "ann", 200}) {
+		t.Fatal("expected structs matching on the named fields to match")
+	}
+
+	if cmp(user{1, "ann", 100}, user{1, "bob", 100}) {
+		t.Fatal("expected structs differing on a named field to mismatch")
+	}
+
+	if !cmp(&user{1, "ann", 100}, &user{2, "ann", 200}) {
+		t.Fatal("expected pointers to structs to be compared on the named fields")
+	}
+
+	if FieldsComparator("Missing")(user{}, user{}) {
+		t.Fatal("expected structs without a named field to mismatch")
+	}
+
+	if cmp(user{Name: "ann"}, struct{ Name string }{"ann"}) {
+		t.Fatal("expected structs of different types to mismatch")
+	}
+
+	type base struct{ Owner string }
+	type rec struct {
+		*base
+		Name string
+	}
+	owner := FieldsComparator("Owner")
+	if !owner(rec{Name: "a"}, rec{Name: "b"}) {
+		t.Fatal("expected fields behind nil embedded pointers in both structs to match")
+	}
+	if owner(rec{}, rec{base: &base{}}) {
+		t.Fatal("expected a field behind a nil embedded pointer in one struct to mismatch")
+	}
+	if !owner(rec{base: &base{"ann"}}, rec{base: &base{"ann"}}) {
+		t.Fatal("expected fields behind embedded pointers to be compared")
+	}
+}
+
+func TestTransformComparator(t *testing.T) {
+	lower := TransformComparator(func(v interface{}) interface{} {
+		return strings.ToLower(v.(string))
+	}, nil)
+
+	if !lower("Hello", "hELLO") {
+		t.Fatal("expected transformed values to match")
+	}
+
+	if lower("Hello", "World") {
+		t.Fatal("expected different transformed values to mismatch")
+	}
+
+	sorted := TransformComparator(func(v interface{}) interface{} {
+		return strings.Fields(v.(string))
+	}, UnorderedSliceComparator)
+
+	if !sorted("a b c", "c a b") {
+		t.Fatal("expected the inner comparator to be used")
+	}
+}
+
+func TestNumericComparator(t *testing.T) {
+	exact := NumericComparator(0)
+
+	if !exact(3, float64(3)) || !exact(uint8(3), int64(3)) {
+		t.Fatal("expected equal numbers of different types to match")
+	}
+
+	if exact(3, 3.5) {
+		t.Fatal("expected different numbers to mismatch")
+	}
+
+	if !NumericComparator(0.01)(1.0, 1.005) {
+		t.Fatal("expected numbers within the tolerance to match")
+	}
+
+	big := int64(1<<62 + 1)
+	if exact(big, big-1) || !exact(big, big) {
+		t.Fatal("expected large integers to be compared exactly")
+	}
+
+	if exact(math.NaN(), math.NaN()) {
+		t.Fatal("expected NaN not to match")
+	}
+
+	if !exact(math.Inf(1), math.Inf(1)) || exact(math.Inf(1), math.MaxFloat64) {
+		t.Fatal("expected infinities to match only themselves")
+	}
+
+	if exact("3", 3) {
+		t.Fatal("expected non-numbers to be compared with DeepEqual")
+	}
+}
+
+func TestIgnoreMapKeysComparator(t *testing.T) {
+	cmp := IgnoreMapKeysComparator("request_id", "timestamp")
+
+	a := map[string]interface{}{"name": "ann", "request_id": "a1", "timestamp": 1}
+	b := map[string]interface{}{"name": "ann", "request_id": "b2"}
+
+	if !cmp(a, b) {
+		t.Fatal("expected maps differing only in ignored keys to match")
+	}
+
+	if len(a) != 3 || len(b) != 2 {
+		t.Fatal("expected the original maps not to be modified")
+	}
+
+	b["name"] = "bob"
+	if cmp(a, b) {
+		t.Fatal("expected maps differing in other keys to mismatch")
+	}
+
+	type key string
+	if !cmp(map[key]int{"request_id": 1, "n": 2}, map[key]int{"request_id": 3, "n": 2}) {
+		t.Fatal("expected named string key types to be supported")
+	}
+
+	if cmp(map[string]int{"n": 1}, map[int]int{1: 1}) {
+		t.Fatal("expected maps of different types to mismatch")
+	}
+}
+
+func TestChannelComparators(t *testing.T) {
+	feed := func(vals ...int) <-chan int {
+		c := make(chan int, len(vals))
+		for _, v := range vals {
+			c <- v
+		}
+		close(c)
+		return c
+	}
+
+	ordered := ChannelComparator(10)
+	if !ordered(feed(1, 2, 3), feed(1, 2, 3)) {
+		t.Fatal("expected channels with the same values to match")
+	}
+
+	if ordered(feed(1, 2, 3), feed(3, 2, 1)) {
+		t.Fatal("expected channels in a different order to mismatch")
+	}
+
+	unordered := UnorderedChannelComparator(10)
+	if !unordered(feed(1, 2, 3), feed(3, 1, 2)) {
+		t.Fatal("expected unordered channels with the same values to match")
+	}
+
+	if unordered(feed(1, 2), feed(1, 2, 2)) {
+		t.Fatal("expected channels with different counts to mismatch")
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	infinite := func(v int) <-chan int {
+		c := make(chan int)
+		go func() {
+			for {
+				select {
+				case c <- v:
+				case <-done:
+					return
+				}
+			}
+		}()
+		return c
+	}
+
+	if !ChannelComparator(5)(infinite(1), infinite(1)) {
+		t.Fatal("expected draining to stop at the limit")
+	}
+}
+
+func TestDeepEqual(t *testing.T) {
+	type celsius float64
+
+	for _, c := range []struct {
+		a, b interface{}
+		want bool
+	}{
+		{1, 1, true},
+		{1, 2, false},
+		{1, int64(1), false},
+		{"a", "a", true},
+		{celsius(1.5), celsius(1.5), true},
+		{celsius(1.5), 1.5, false},
+		{math.NaN(), math.NaN(), false},
+		{[]int{1}, []int{1}, true},
+		{map[string]int{"a": 1}, map[string]int{"a": 2}, false},
+		{nil, nil, true},
+		{nil, 0, false},
+	} {
+		if got := DeepEqual(c.a, c.b); got != c.want {
+			t.Errorf("DeepEqual(%#v, %#v) = %v, want %v", c.a, c.b, got, c.want)
+		}
+		if got := reflect.DeepEqual(c.a, c.b); got != c.want {
+			t.Errorf("reflect.DeepEqual(%#v, %#v) = %v, want %v", c.a, c.b, got, c.want)
+		}
+	}
+}
+
+func BenchmarkDeepEqual(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		DeepEqual(42, 42)
+	}
+}
+
+func BenchmarkReflectDeepEqual(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		reflect.DeepEqual(42, 42)
+	}
+}
+
+func TestJSONCanonicalComparator(t *testing.T) {
+	type user struct {
+		Name string `json:"name"`
+		Age  int    `json:"age"`
+	}
+
+	if !JSONCanonicalComparator(user{"ann", 30}, map[string]interface{}{"age": 30.0, "name": "ann"}) {
+		t.Fatal("expected values with the same JSON to match")
+	}
+
+	if !JSONCanonicalComparator(&user{"ann", 30}, user{"ann", 30}) {
+		t.Fatal("expected a pointer to match its value")
+	}
+
+	if JSONCanonicalComparator(user{"ann", 30}, user{"ann", 31}) {
+		t.Fatal("expected values with different JSON to mismatch")
+	}
+}
+
+func TestJSONCanonicalComparatorReportsErrors(t *testing.T) {
+	e := NewExperiment("test")
+	e.Comparator = JSONCanonicalComparator
+	e.Control = func() interface{} { return 1 }
+	e.Candidate = func() interface{} { return make(chan int) }
+
+	var result *Result
+	e.Publish = func(r *Result) { result = r }
+	e.Run()
+
+	if result.ComparisonErr == nil || result.Compared {
+		t.Fatal("expected the marshal error to be recorded instead of a mismatch")
+	}
+
+	var jsonErr *json.UnsupportedTypeError
+	if !errors.As(result.ComparisonErr, &jsonErr) {
+		t.Fatalf("expected the JSON error to be wrapped, got %v", result.ComparisonErr)
+	}
+}
+
+func TestReaderComparator(t *testing.T) {
+	cmp := ReaderComparator(16)
+
+	control := strings.NewReader("hello")
+	if !cmp(control, bytes.NewBufferString("hello")) {
+		t.Fatal("expected readers with the same contents to match")
+	}
+
+	if cmp(strings.NewReader("hello"), strings.NewReader("help")) {
+		t.Fatal("expected readers with different contents to mismatch")
+	}
+
+	b, _ := io.ReadAll(control)
+	if string(b) != "hello" {
+		t.Fatalf("expected a seekable reader to be rewound, read %q", b)
+	}
+
+	if !cmp(42, 42) || cmp(42, 43) {
+		t.Fatal("expected non-readers to be compared with DeepEqual")
+	}
+}
+
+func TestReaderComparatorLimit(t *testing.T) {
+	e := NewExperiment("test")
+	e.Comparator = ReaderComparator(4)
+	e.Control = func() interface{} { return strings.NewReader("1234") }
+	e.Candidate = func() interface{} { return strings.NewReader("12345") }
+
+	var result *Result
+	e.Publish = func(r *Result) { result = r }
+	e.Run()
+
+	if result.ComparisonErr == nil || result.Compared {
+		t.Fatal("expected a reader over the limit to be recorded as a comparison error")
+	}
+}
+
+func TestNilEmptyEquivalentComparator(t *testing.T) {
+	type page struct {
+		Items []string
+		Meta  map[string]int
+		Next  *page
+	}
+	cmp := NilEmptyEquivalentComparator(nil)
+
+	if !cmp([]int(nil), []int{}) || !cmp(map[string]int{}, map[string]int(nil)) {
+		t.Fatal("expected nil and empty values to match")
+	}
+
+	control := page{Next: &page{Items: []string{"a"}}}
+	candidate := page{Items: []string{}, Meta: map[string]int{}, Next: &page{Items: []string{"a"}, Meta: map[string]int{}}}
+	if !cmp(control, candidate) {
+		t.Fatal("expected nested nil and empty values to match")
+	}
+	if candidate.Items == nil || candidate.Next.Meta == nil {
+		t.Fatal("expected the original values not to be modified")
+	}
+
+	if cmp([]int{}, []int{0}) {
+		t.Fatal("expected non-empty slices to still be compared")
+	}
+
+	if !cmp([]interface{}{[]int{}}, []interface{}{[]int(nil)}) {
+		t.Fatal("expected values inside interfaces to be normalized")
+	}
+
+	cyclic := &page{Items: []string{}}
+	cyclic.Next = cyclic
+	if !cmp(cyclic, cyclic) {
+		t.Fatal("expected cyclic values to be compared")
+	}
+
+	type inner struct{ Items []string }
+	type outer struct{ In inner }
+	type both struct {
+		Outer *outer
+		Inner *inner
+	}
+	o := &outer{In: inner{Items: []string{}}}
+	if !cmp(both{o, &o.In}, both{&outer{}, &inner{}}) {
+		t.Fatal("expected a pointer to a struct and to its first field to be copied separately")
+	}
+
+	strict := NilEmptyEquivalentComparator(func(a, b interface{}) bool { return false })
+	if strict(nil, nil) {
+		t.Fatal("expected the inner comparator to be used")
+	}
+}
+
+func TestRoundTimesComparator(t *testing.T) {
+	type event struct {
+		At   time.Time
+		Seen *time.Time
+		Tags map[string]interface{}
+	}
+	cmp := RoundTimesComparator(time.Second, nil)
+
+	base := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	near := base.Add(300 * time.Millisecond)
+	far := base.Add(2 * time.Second)
+
+	if !cmp(base, near) || cmp(base, far) {
+		t.Fatal("expected top-level times to be rounded")
+	}
+
+	control := []event{{At: base, Seen: &base, Tags: map[string]interface{}{"t": base}}}
+	candidate := []event{{At: near, Seen: &near, Tags: map[string]interface{}{"t": near}}}
+	if !cmp(control, candidate) {
+		t.Fatal("expected nested times to be rounded")
+	}
+	if !candidate[0].At.Equal(near) || !candidate[0].Seen.Equal(near) {
+		t.Fatal("expected the original values not to be modified")
+	}
+
+	candidate[0].Tags["t"] = far
+	if cmp(control, candidate) {
+		t.Fatal("expected times further apart than the granularity to mismatch")
+	}
+
+	now := time.Now()
+	if !RoundTimesComparator(0, nil)(now, now.Round(0)) {
+		t.Fatal("expected monotonic clock readings to be ignored")
+	}
+
+	first := &event{At: base}
+	if !cmp([]interface{}{first, &first.At}, []interface{}{&event{At: near}, &near}) {
+		t.Fatal("expected a pointer to a struct and to its first field to be copied separately")
+	}
+}
+
+func TestBigComparator(t *testing.T) {
+	unnormalized := new(big.Rat)
+	unnormalized.SetFrac(big.NewInt(4), big.NewInt(2))
+
+	if !BigComparator(big.NewRat(2, 1), unnormalized) {
+		t.Fatal("expected equal rationals to match")
+	}
+
+	if !BigComparator(big.NewInt(2), big.NewRat(4, 2)) || !BigComparator(big.NewFloat(0.5), big.NewRat(1, 2)) {
+		t.Fatal("expected equal values of different big types to match")
+	}
+
+	if BigComparator(big.NewInt(2), big.NewInt(3)) || BigComparator(big.NewFloat(0.1), big.NewRat(1, 10)) {
+		t.Fatal("expected different values to mismatch")
+	}
+
+	inf := new(big.Float).SetInf(false)
+	if !BigComparator(inf, new(big.Float).SetInf(false)) || BigComparator(inf, big.NewInt(1)) {
+		t.Fatal("expected infinities to match only each other")
+	}
+
+	if BigComparator(inf, new(big.Float).SetInf(true)) || BigComparator(inf, big.NewRat(1, 2)) {
+		t.Fatal("expected infinities of different signs to mismatch")
+	}
+
+	if BigComparator(inf, (*big.Int)(nil)) || BigComparator((*big.Float)(nil), inf) {
+		t.Fatal("expected a nil big number not to match an infinity")
+	}
+
+	if !BigComparator((*big.Int)(nil), (*big.Rat)(nil)) || BigComparator((*big.Int)(nil), big.NewInt(0)) {
+		t.Fatal("expected nil big numbers to match only each other")
+	}
+
+	if !BigComparator(42, 42) || BigComparator(big.NewInt(42), 42) {
+		t.Fatal("expected other values to be compared with DeepEqual")
+	}
+}
+
+func TestMatrixComparator(t *testing.T) {
+	cmp := MatrixComparator(1e-9)
+
+	control := [][]float64{{0.1 + 0.2, 1}, {2, 3}}
+	candidate := [][]float64{{0.3, 1}, {2, 3}}
+	if !cmp(control, candidate) {
+		t.Fatal("expected matrices within epsilon to match")
+	}
+
+	if cmp(control, [][]float64{{0.3, 1}, {2, 3.1}}) {
+		t.Fatal("expected matrices further apart than epsilon to mismatch")
+	}
+
+	if cmp(control, [][]float64{{0.3, 1}, {2}}) || cmp(control, [][]float64{{0.3, 1}}) {
+		t.Fatal("expected matrices of different shapes to mismatch")
+	}
+
+	if cmp([]interface{}{1.0, []float64{2}}, []interface{}{1.0, 2.0}) {
+		t.Fatal("expected a row and a number to mismatch without panicking")
+	}
+
+	if cmp([]float64{math.NaN()}, []float64{math.NaN()}) {
+		t.Fatal("expected NaN not to match")
+	}
+
+	if !cmp([]float64{math.Inf(1)}, []float64{math.Inf(1)}) {
+		t.Fatal("expected equal infinities to match")
+	}
+
+	if !cmp("a", "a") || cmp("a", "b") || !cmp(nil, nil) || cmp(nil, []float64{}) {
+		t.Fatal("expected other values to be compared with DeepEqual")
+	}
+}
+
+func TestMapFloatComparator(t *testing.T) {
+	cmp := MapFloatComparator(1e-9)
+	tenth := 0.1
+	sum := tenth + 0.2 // 0.30000000000000004
+
+	control := map[string]float64{"a": sum, "b": 1}
+	if !cmp(control, map[string]float64{"a": 0.3, "b": 1}) {
+		t.Fatal("expected maps within epsilon to match")
+	}
+
+	if cmp(control, map[string]float64{"a": 0.3, "b": 1.1}) {
+		t.Fatal("expected maps further apart than epsilon to mismatch")
+	}
+
+	if cmp(control, map[string]float64{"a": 0.3}) || cmp(control, map[string]float64{"a": 0.3, "c": 1}) {
+		t.Fatal("expected missing and extra keys to mismatch")
+	}
+
+	nested := map[string]interface{}{"v": map[string]float64{"x": sum}, "w": []float64{sum}}
+	if !cmp(nested, map[string]interface{}{"v": map[string]float64{"x": 0.3}, "w": []float64{0.3}}) {
+		t.Fatal("expected nested maps and slices to be compared within epsilon")
+	}
+
+	if cmp(nested, map[string]interface{}{"v": 0.3, "w": []float64{0.3}}) {
+		t.Fatal("expected a map and a number to mismatch")
+	}
+
+	if cmp(map[string]float64{"a": 1}, map[int]float64{1: 1}) {
+		t.Fatal("expected maps with different key types to mismatch without panicking")
+	}
+
+	if !cmp(map[string]float64(nil), map[string]float64{}) {
+		t.Fatal("expected a nil map to match an empty one")
+	}
+
+	if MatrixComparator(1e-9)(map[string]float64{"a": sum}, map[string]float64{"a": 0.3}) {
+		t.Fatal("expected MatrixComparator to keep comparing maps exactly")
+	}
+}
+
+// money is an amount in cents whose currency is ignored when comparing.
+type money struct {
+	cents    int64
+	currency string
+}
+
+func (m money) CmpTo(other interface{}) int {
+	o := other.(money)
+	switch {
+	case m.cents < o.cents:
+		return -1
+	case m.cents > o.cents:
+		return 1
+	}
+	return 0
+}
+
+func TestComparableComparator(t *testing.T) {
+	if !ComparableComparator(money{100, "USD"}, money{100, "usd"}) {
+		t.Fatal("expected CmpTo to decide equality")
+	}
+
+	if ComparableComparator(money{100, "USD"}, money{101, "USD"}) {
+		t.Fatal("expected different amounts to mismatch")
+	}
+
+	if !ComparableComparator(big.NewRat(1, 2), big.NewRat(2, 4)) {
+		t.Fatal("expected big numbers to be compared by value")
+	}
+
+	if ComparableComparator(money{100, "USD"}, 100) || !ComparableComparator(1, 1) {
+		t.Fatal("expected other values to be compared with DeepEqual")
+	}
+}
+
+func TestDeepEqualOr(t *testing.T) {
+	type doc struct {
+		Title string
+		Body  []float64
+	}
+
+	calls := 0
+	cmp := DeepEqualOr(func(a, b interface{}) bool {
+		calls++
+		return MatrixComparator(0.5)(a.(doc).Body, b.(doc).Body)
+	})
+
+	if !cmp(doc{"a", []float64{1, 2}}, doc{"a", []float64{1, 2}}) || calls != 0 {
+		t.Fatalf("expected equal values to match without the inner comparator, got %d calls", calls)
+	}
+
+	if !cmp(doc{"a", []float64{1, 2}}, doc{"a", []float64{1, 2.1}}) || calls != 1 {
+		t.Fatal("expected unequal values to be decided by the inner comparator")
+	}
+
+	if cmp(doc{"a", []float64{1, 2}}, doc{"a", []float64{1, 3}}) {
+		t.Fatal("expected the inner comparator's mismatch to be kept")
+	}
+
+	if DeepEqualOr(nil)(1, 1.0) {
+		t.Fatal("expected values of different types to mismatch")
+	}
+
+	calls = 0
+	strict := DeepEqualOr(func(a, b interface{}) bool {
+		calls++
+		return false
+	})
+	if strict([]interface{}{1}, []interface{}{1.0}) || calls != 1 {
+		t.Fatal("expected values with equal JSON encodings to be decided by the inner comparator")
+	}
+
+	type secret struct {
+		Name string
+		key  string
+	}
+	if DeepEqualOr(nil)(secret{"a", "x"}, secret{"a", "y"}) {
+		t.Fatal("expected values differing only in unexported fields to mismatch")
+	}
+}
+
+func TestScoreComparator(t *testing.T) {
+	overlap := func(a, b interface{}) float64 {
+		x, y := a.([]string), b.([]string)
+		same := 0
+		for i := range x {
+			if i < len(y) && x[i] == y[i] {
+				same++
+			}
+		}
+		return float64(same) / float64(len(x))
+	}
+	cmp := ScoreComparator(overlap, 0.75)
+
+	if !cmp([]string{"a", "b", "c", "d"}, []string{"a", "b", "c", "e"}) {
+		t.Fatal("expected a score at the threshold to match")
+	}
+	if cmp([]string{"a", "b", "c", "d"}, []string{"a", "b", "e", "f"}) {
+		t.Fatal("expected a score below the threshold to mismatch")
+	}
+}
+
+func TestStructComparator(t *testing.T) {
+	type ranking struct {
+		Score   float64
+		Label   string
+		Debug   string
+		private int
+	}
+	cmp := StructComparator(map[string]ComparatorFunc{
+		"Score": NumericComparator(0.01),
+		"Debug": nil,
+	})
+
+	control := ranking{Score: 0.5, Label: "a", Debug: "took 3ms", private: 1}
+	if !cmp(control, &ranking{Score: 0.505, Label: "a", Debug: "took 2ms", private: 1}) {
+		t.Fatal("expected per-field comparators to be used and nil ones to be ignored")
+	}
+
+	if cmp(control, ranking{Score: 0.6, Label: "a", private: 1}) {
+		t.Fatal("expected a field's comparator mismatch to be kept")
+	}
+	if cmp(control, ranking{Score: 0.5, Label: "b", private: 1}) {
+		t.Fatal("expected fields without a comparator to be compared exactly")
+	}
+	if cmp(control, ranking{Score: 0.5, Label: "a", private: 2}) {
+		t.Fatal("expected unexported fields to be compared")
+	}
+	if control.Score != 0.5 || control.Debug != "took 3ms" {
+		t.Fatal("expected the values not to be modified")
+	}
+
+	e := NewExperiment("test")
+	e.Logger = &testLogger{}
+	e.Comparator = cmp
+	e.Control = func() interface{} { return 1 }
+	e.Candidate = func() interface{} { return 1 }
+
+	var result *Result
+	e.Publish = func(r *Result) { result = r }
+	e.Run()
+	if result.ComparisonErr == nil || !strings.Contains(result.ComparisonErr.Error(), "not structs") {
+		t.Fatalf("expected values that are not structs to be an error, got %v", result.ComparisonErr)
+	}
+
+	e.Comparator = StructComparator(map[string]ComparatorFunc{"Missing": nil})
+	e.Control = func() interface{} { return control }
+	e.Candidate = func() interface{} { return control }
+	e.Run()
+	if result.ComparisonErr == nil || !strings.Contains(result.ComparisonErr.Error(), "no exported field Missing") {
+		t.Fatalf("expected an unknown field to be an error, got %v", result.ComparisonErr)
+	}
+}
@@ -0,0 +1,38 @@
+package science
+
+// Config is a snapshot of the settings that decided how an experiment ran,
+// copied onto each Result so that the result itself shows how the
+// experiment was configured at the time, for example when investigating
+// unexpected coverage on a dashboard.
+type Config struct {
+	SamplePercent   float64 // Percent of SampleKey values sampled, or 100 if SampleKey is nil
+	Async           bool    // Whether the result was published asynchronously
+	Shadow          bool    // Whether the candidate ran in the background
+	ReturnCandidate bool    // Whether the candidate's value could be returned
+	ReturnFaster    bool    // Whether the faster branch's value could be returned
+	BaselineOnly    bool    // Whether only the control was measured
+	Disabled        bool    // Whether all experiments were disabled with SetDisabled
+	Paused          bool    // Whether the experiment was paused
+	BreakerTripped  bool    // Whether the experiment's breaker had tripped
+	ComparatorName  string  // Name of the registered comparator, if ComparatorName was set
+}
+
+// config returns a snapshot of the experiment's current configuration.
+func (e *Experiment) config() Config {
+	percent := 100.0
+	if e.SampleKey != nil {
+		percent = e.SamplePercent
+	}
+	return Config{
+		SamplePercent:   percent,
+		Async:           e.Async,
+		Shadow:          e.Shadow,
+		ReturnCandidate: e.ReturnCandidate,
+		ReturnFaster:    e.ReturnFaster,
+		BaselineOnly:    e.BaselineOnly,
+		Disabled:        Disabled(),
+		Paused:          e.Paused(),
+		BreakerTripped:  e.breakerTripped(),
+		ComparatorName:  e.ComparatorName,
+	}
+}
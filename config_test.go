@@ -0,0 +1,43 @@
+package science
+
+import "testing"
+
+func TestResultConfig(t *testing.T) {
+	e := NewExperiment("test")
+	e.AlwaysPublish = true
+	e.BreakerThreshold = 1
+	e.ComparatorName = "deep-equal"
+	e.Control = func() interface{} { return 1 }
+	e.Candidate = func() interface{} { return 2 }
+
+	var result *Result
+	e.Publish = func(r *Result) { result = r }
+
+	e.Run()
+	want := Config{SamplePercent: 100, ComparatorName: "deep-equal"}
+	if result.Config != want {
+		t.Fatalf("expected %+v, got %+v", want, result.Config)
+	}
+
+	e.Run()
+	if !result.Config.BreakerTripped || result.SkipReason != SkipBreaker {
+		t.Fatalf("expected the tripped breaker to be recorded, got %+v", result.Config)
+	}
+
+	e.ResetBreaker()
+	e.Pause()
+	e.SampleKey = func() string { return "user" }
+	e.SamplePercent = 5
+	e.Run()
+	if !result.Config.Paused || result.Config.BreakerTripped || result.Config.SamplePercent != 5 {
+		t.Fatalf("expected the pause and sample percent to be recorded, got %+v", result.Config)
+	}
+
+	e.Resume()
+	SetDisabled(true)
+	defer SetDisabled(false)
+	e.Run()
+	if !result.Config.Disabled || result.Config.Paused {
+		t.Fatalf("expected the global switch to be recorded, got %+v", result.Config)
+	}
+}
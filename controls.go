@@ -0,0 +1,79 @@
+package science
+
+import (
+	"context"
+	"sort"
+)
+
+// compareExtraControls runs the experiment's ExtraControls and compares each
+// with the candidate in the result, clearing Matched if any of them differ.
+// They are only compared if the control and candidate were, and the
+// candidate neither panicked nor returned a value of the wrong type.
+func (e *Experiment) compareExtraControls(ctx context.Context, comparator ComparatorFunc, result *Result) {
+	comparable := result.Compared && !result.Candidate.Panicked && !result.TypeMismatch
+
+	result.ExtraControls = make(map[string]*Observation, len(e.ExtraControls))
+	result.ExtraMatched = make(map[string]bool, len(e.ExtraControls))
+	for _, name := range sortedNames(e.ExtraControls) {
+		o := e.observe(name, e.ExtraControls[name], true)
+		result.ExtraControls[name] = o
+
+		if o.Panicked {
+			e.logf("science: experiment %q: extra control %q panicked: %v", e.Name, name, o.Panic)
+			continue
+		}
+		if !comparable {
+			continue
+		}
+
+		a, b := o.Value, result.Candidate.Value
+		if e.CompareCleaned {
+			var okA, okB bool
+			a, okA = e.clean(o)
+			b, okB = e.clean(result.Candidate)
+			if !okA || !okB {
+				continue
+			}
+		}
+		matched, timedOut, cancelled, err := e.callComparator(ctx, comparator, a, b)
+		switch {
+		case timedOut:
+			e.logf("science: experiment %q: comparator timed out after %v for extra control %q", e.Name, e.ComparatorTimeout, name)
+			continue
+		case cancelled:
+			e.logf("science: experiment %q: comparison abandoned for extra control %q: %v", e.Name, name, ctx.Err())
+			continue
+		case err != nil:
+			e.logf("science: experiment %q: comparator failed for extra control %q: %v", e.Name, name, err)
+			continue
+		}
+
+		result.ExtraMatched[name] = matched
+		if !matched {
+			result.Matched = false
+		}
+	}
+}
+
+// copyControls returns a copy of the ExtraControls map m, so that a clone's
+// extra controls can be changed without affecting the original's.
+func copyControls(m map[string]ExperimentFunc) map[string]ExperimentFunc {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]ExperimentFunc, len(m))
+	for name, f := range m {
+		c[name] = f
+	}
+	return c
+}
+
+// sortedNames returns the keys of m in order.
+func sortedNames[V any](m map[string]V) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
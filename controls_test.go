@@ -0,0 +1,50 @@
+package science
+
+import "testing"
+
+func TestExperimentExtraControls(t *testing.T) {
+	e := NewExperiment("test")
+	e.Control = func() interface{} { return 1 }
+	e.Candidate = func() interface{} { return 1 }
+	e.ExtraControls = map[string]ExperimentFunc{
+		"legacy-a": func() interface{} { return 1 },
+		"legacy-b": func() interface{} { return 2 },
+	}
+
+	var result *Result
+	e.Publish = func(r *Result) { result = r }
+
+	if v, _ := e.RunValue(); v != 1 {
+		t.Fatal("expected the primary control's value to be returned")
+	}
+
+	if result.Matched {
+		t.Fatal("expected a mismatch with any extra control to be a mismatch")
+	}
+	if !result.ExtraMatched["legacy-a"] || result.ExtraMatched["legacy-b"] {
+		t.Fatalf("expected per control match status, got %v", result.ExtraMatched)
+	}
+	if result.ExtraControls["legacy-b"].Value != 2 {
+		t.Fatal("expected the extra controls' observations in the result")
+	}
+
+	e.ExtraControls["legacy-b"] = func() interface{} { panic("broken") }
+	e.Run()
+	if !result.Matched || !result.ExtraControls["legacy-b"].Panicked {
+		t.Fatal("expected a panicking extra control to be recorded and left out")
+	}
+	if _, ok := result.ExtraMatched["legacy-b"]; ok {
+		t.Fatal("expected a panicking extra control not to be compared")
+	}
+}
+
+func TestExperimentCloneCopiesExtraControls(t *testing.T) {
+	e := NewExperiment("test")
+	e.ExtraControls = map[string]ExperimentFunc{"a": func() interface{} { return 1 }}
+
+	c := e.Clone()
+	c.ExtraControls["b"] = func() interface{} { return 2 }
+	if len(e.ExtraControls) != 1 {
+		t.Fatal("expected the clone to have its own ExtraControls")
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package science
+
+import (
+	"time"
+)
+
+// threadCPUTime is only supported on Linux; elsewhere CPU time is not
+// measured.
+func threadCPUTime() (time.Duration, bool) {
+	return 0, false
+}
@@ -0,0 +1,55 @@
+package science
+
+import "sync"
+
+// DefaultEventsBuffer is the capacity of the Events channel used when an
+// experiment's EventsBuffer is not set.
+const DefaultEventsBuffer = 100
+
+// events holds an experiment's Events channel, created on first use.
+type events struct {
+	sync.Mutex
+	ch chan *Result
+}
+
+// Events returns a channel on which the experiment sends every Result it
+// publishes, for consumers that prefer to select on a channel rather than
+// be called back. It is an addition to Publish, not a replacement: results
+// are still passed to Publish if it is set.
+//
+// The channel is created on the first call, with room for EventsBuffer
+// results, and later calls return the same channel. Results are sent
+// without blocking, so a slow consumer never holds up a run; results that
+// do not fit in the buffer are dropped and counted in Stats.Dropped. Results
+// sent before the first call to Events are not delivered. The channel is
+// never closed.
+func (e *Experiment) Events() <-chan *Result {
+	e.events.Lock()
+	defer e.events.Unlock()
+
+	if e.events.ch == nil {
+		size := e.EventsBuffer
+		if size <= 0 {
+			size = DefaultEventsBuffer
+		}
+		e.events.ch = make(chan *Result, size)
+	}
+	return e.events.ch
+}
+
+// sendEvent sends the result on the Events channel, if there is one.
+func (e *Experiment) sendEvent(result *Result) {
+	e.events.Lock()
+	ch := e.events.ch
+	e.events.Unlock()
+
+	if ch == nil {
+		return
+	}
+
+	select {
+	case ch <- result:
+	default:
+		e.counters.dropped.Add(1)
+	}
+}
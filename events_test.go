@@ -0,0 +1,56 @@
+package science
+
+import "testing"
+
+func TestExperimentEvents(t *testing.T) {
+	e := NewExperiment("test")
+	e.Control = func() interface{} { return 1 }
+	e.Candidate = func() interface{} { return 2 }
+	e.EventsBuffer = 2
+
+	published := 0
+	e.Publish = func(r *Result) { published++ }
+
+	events := e.Events()
+	if e.Events() != events {
+		t.Fatal("expected Events to return the same channel each time")
+	}
+
+	e.Run()
+	e.Run()
+	e.Run()
+
+	if published != 3 {
+		t.Fatalf("expected Publish to still receive every result, got %d", published)
+	}
+
+	for i := 0; i < 2; i++ {
+		r := <-events
+		if r.Matched || r.Candidate.Value != 2 {
+			t.Fatal("expected the run's result on the events channel")
+		}
+	}
+
+	select {
+	case <-events:
+		t.Fatal("expected results beyond the buffer to be dropped")
+	default:
+	}
+
+	if e.Stats().Dropped != 1 {
+		t.Fatalf("expected 1 dropped result, got %d", e.Stats().Dropped)
+	}
+}
+
+func TestExperimentEventsWithoutPublish(t *testing.T) {
+	e := NewExperiment("test")
+	e.Control = func() interface{} { return 1 }
+	e.Candidate = func() interface{} { return 1 }
+
+	events := e.Events()
+	e.Run()
+
+	if r := <-events; !r.Matched {
+		t.Fatal("expected results to be sent with no Publish function set")
+	}
+}
@@ -0,0 +1,156 @@
+package science
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Explain returns a human readable description of how the experiment is
+// configured and how it will behave when run. It does not call any of the
+// experiment's functions.
+func (e *Experiment) Explain() string {
+	var b strings.Builder
+	line := func(format string, v ...interface{}) {
+		fmt.Fprintf(&b, "  "+format+"\n", v...)
+	}
+
+	fmt.Fprintf(&b, "experiment %q\n", e.Name)
+
+	line("control: %s", describeBranch(e.Control != nil, e.ControlFn != nil))
+	line("candidate: %s", describeBranch(e.Candidate != nil, e.CandidateFn != nil))
+	if e.Setup != nil {
+		line("setup: Setup provides the input for ControlFn and CandidateFn on every run")
+	}
+
+	switch {
+	case e.Score != nil:
+		line("comparator: Score, matching at %v or above", e.ScoreThreshold)
+	case e.ComparatorName != "" && ComparatorByName(e.ComparatorName) == nil:
+		line("comparator: %q is not registered", e.ComparatorName)
+	case e.ComparatorName != "":
+		line("comparator: %q", e.ComparatorName)
+	case e.Comparator != nil:
+		line("comparator: set")
+	case DefaultComparator != nil:
+		line("comparator: DefaultComparator")
+	default:
+		line("comparator: missing")
+	}
+	if e.ContextComparator != nil && e.Score == nil {
+		line("context comparator: ContextComparator is used by RunContext")
+	}
+
+	switch {
+	case Disabled():
+		line("enabled: no, all experiments are disabled")
+	case e.Paused():
+		line("enabled: no, paused")
+	case e.BaselineOnly:
+		line("enabled: no, baseline only, the control is measured and published")
+	case e.BreakerTripped():
+		line("enabled: no, breaker tripped")
+	case e.enabledFunc() == nil && e.ContextEnabled == nil:
+		line("enabled: no, Enabled is nil")
+	case e.enabledFunc() != nil && sameFunc(e.enabledFunc(), enabledByDefault):
+		line("enabled: always")
+	default:
+		line("enabled: decided by Enabled or ContextEnabled on each run")
+	}
+	if e.ContextEnabled != nil {
+		line("context enabled: ContextEnabled is used by RunContext")
+	}
+	if e.SampleKey != nil {
+		line("sampling: candidate runs for %v%% of SampleKey values", e.SamplePercent)
+	}
+	if e.BreakerThreshold > 0 {
+		line("breaker: trips after %d consecutive candidate failures", e.BreakerThreshold)
+	}
+
+	switch {
+	case e.Shadow:
+		line("ordering: control runs first, candidate runs in the background")
+	case e.controlRunsFirst():
+		line("ordering: control runs first")
+	default:
+		line("ordering: candidate runs first")
+	}
+
+	switch {
+	case e.publishFunc() == nil:
+		line("publish: none")
+	case e.Async:
+		line("publish: asynchronous")
+	case e.PublishTimeout > 0:
+		line("publish: synchronous, waiting at most %v", e.PublishTimeout)
+	default:
+		line("publish: synchronous")
+	}
+	if e.AlwaysPublish {
+		line("always publish: results are published when the candidate does not run")
+	}
+	if e.SkipPublishOnMatchedError {
+		line("skip publish: matching results are not published when both branches return equal errors")
+	}
+	if e.OnMismatch != nil {
+		line("on mismatch: OnMismatch is called")
+	}
+	if e.ErrorOnMismatch {
+		line("on mismatch: Run returns ErrMismatch")
+	}
+	if e.StreamPublish != nil {
+		line("stream publish: partial results every %v", e.streamInterval())
+	}
+
+	if e.Warmup > 0 {
+		line("warmup: first %d runs", e.Warmup)
+	}
+
+	switch {
+	case e.Shadow:
+		line("returns: control value")
+	case e.ReturnCandidate:
+		line("returns: candidate value when it matches, otherwise control value")
+	case e.ReturnFaster:
+		line("returns: faster branch's value when they match, otherwise control value")
+	default:
+		line("returns: control value")
+	}
+
+	var values []string
+	if e.HashValues {
+		values = append(values, "hashed")
+	}
+	switch {
+	case e.DiscardValues:
+		values = append(values, "discarded")
+	case e.Redact:
+		values = append(values, "redacted")
+	}
+	if len(values) > 0 {
+		line("published values: %s", strings.Join(values, ", "))
+	}
+
+	if err := e.validate(); err != nil {
+		line("problem: %v", err)
+	}
+
+	return b.String()
+}
+
+func describeBranch(plain, input bool) string {
+	switch {
+	case plain && input:
+		return "set, with input variant for RunWith"
+	case plain:
+		return "set"
+	case input:
+		return "input variant only, use RunWith"
+	}
+	return "missing"
+}
+
+// sameFunc reports whether a and b are the same function.
+func sameFunc(a, b interface{}) bool {
+	return reflect.ValueOf(a).Pointer() == reflect.ValueOf(b).Pointer()
+}
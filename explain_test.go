@@ -0,0 +1,50 @@
+package science
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExperimentExplain(t *testing.T) {
+	defer ClearDeterministicOrder()
+	SetDeterministicOrder(true)
+
+	e := NewExperiment("checkout")
+	e.Control = func() interface{} {
+		t.Fatal("expected Explain not to run the control")
+		return nil
+	}
+	e.Publish = func(*Result) {}
+	e.PublishTimeout = time.Second
+	e.Redact = true
+
+	s := e.Explain()
+	for _, want := range []string{
+		`experiment "checkout"`,
+		"control: set",
+		"candidate: missing",
+		"enabled: always",
+		"ordering: control runs first",
+		"publish: synchronous, waiting at most 1s",
+		"published values: redacted",
+		"problem: candidate function missing",
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("expected explanation to contain %q, got:\n%s", want, s)
+		}
+	}
+
+	e.Async = true
+	e.Pause()
+	s = e.Explain()
+	if !strings.Contains(s, "publish: asynchronous") || !strings.Contains(s, "enabled: no, paused") {
+		t.Errorf("expected explanation to reflect changes, got:\n%s", s)
+	}
+
+	e.Score = func(a, b interface{}) float64 { return 1 }
+	e.ScoreThreshold = 0.9
+	if s = e.Explain(); !strings.Contains(s, "comparator: Score, matching at 0.9 or above") {
+		t.Errorf("expected explanation to describe Score, got:\n%s", s)
+	}
+}
@@ -0,0 +1,15 @@
+package science
+
+// FlagProvider is the minimal interface of a feature flag service, such as
+// LaunchDarkly or Unleash, needed to enable experiments with a flag.
+type FlagProvider interface {
+	BoolVariation(key string) bool
+}
+
+// EnabledFromFlag returns an EnabledFunc which enables the experiment when the
+// provider's flag named key is on. The flag is evaluated on every run.
+func EnabledFromFlag(provider FlagProvider, key string) EnabledFunc {
+	return func() bool {
+		return provider.BoolVariation(key)
+	}
+}
@@ -0,0 +1,27 @@
+package science
+
+import (
+	"testing"
+)
+
+type testFlags map[string]bool
+
+func (f testFlags) BoolVariation(key string) bool { return f[key] }
+
+func TestEnabledFromFlag(t *testing.T) {
+	flags := testFlags{"on": true}
+
+	if !EnabledFromFlag(flags, "on")() {
+		t.Fatal("expected the experiment to be enabled when the flag is on")
+	}
+
+	enabled := EnabledFromFlag(flags, "off")
+	if enabled() {
+		t.Fatal("expected the experiment to be disabled when the flag is off")
+	}
+
+	flags["off"] = true
+	if !enabled() {
+		t.Fatal("expected the flag to be evaluated on every call")
+	}
+}
@@ -0,0 +1,21 @@
+package science
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+)
+
+// hashValue returns a stable 64-bit FNV-1a hash of the JSON encoding of v.
+// Values that cannot be encoded as JSON are hashed using their Go syntax
+// representation instead.
+func hashValue(v interface{}) uint64 {
+	b, err := json.Marshal(v)
+	if err != nil {
+		b = []byte(fmt.Sprintf("%#v", v))
+	}
+
+	h := fnv.New64a()
+	h.Write(b)
+	return h.Sum64()
+}
@@ -0,0 +1,46 @@
+package science
+
+import (
+	"testing"
+)
+
+func TestHashValue(t *testing.T) {
+	type point struct{ X, Y int }
+
+	if hashValue(point{1, 2}) != hashValue(point{1, 2}) {
+		t.Fatal("expected equal values to hash the same")
+	}
+
+	if hashValue(point{1, 2}) == hashValue(point{2, 1}) {
+		t.Fatal("expected different values to hash differently")
+	}
+
+	f := func() {}
+	if hashValue(f) == 0 {
+		t.Fatal("expected values that cannot be encoded as JSON to be hashed")
+	}
+}
+
+func TestExperimentHashValues(t *testing.T) {
+	e := NewExperiment("test")
+	e.HashValues = true
+	e.DiscardValues = true
+	e.Control = func() interface{} { return "value" }
+	e.Candidate = func() interface{} { return "other" }
+
+	var result *Result
+	e.Publish = func(r *Result) { result = r }
+
+	v, _ := e.RunValue()
+	if v.(string) != "value" {
+		t.Fatal("expected the real value to be returned")
+	}
+
+	if result.Control.Hash != hashValue("value") || result.Candidate.Hash != hashValue("other") {
+		t.Fatal("expected the values to be hashed")
+	}
+
+	if result.Control.Value != nil || result.Candidate.Value != nil {
+		t.Fatal("expected the values to be discarded")
+	}
+}
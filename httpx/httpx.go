@@ -0,0 +1,282 @@
+// Package httpx runs science experiments on net/http handlers and clients,
+// so that a refactored handler can be tested against real traffic while
+// clients keep getting the original handler's responses, and a new client or
+// downstream endpoint can be shadow tested while callers keep getting the
+// original's responses.
+package httpx
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"github.com/rubyist/science"
+)
+
+// Response is the part of a handler's response that is compared. Each
+// branch's value in the experiment's results is a *Response, and comparators
+// set with science.WithComparator are given two of them.
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// served is the input of each branch of a Handler experiment: the request,
+// the client's ResponseWriter, which only the control writes to, and, once
+// the candidate is known to run, the request body, which both branches read.
+type served struct {
+	w      http.ResponseWriter
+	r      *http.Request
+	header http.Header // the response header before either branch ran
+	record bool        // whether the candidate runs, so the control is recorded
+	body   *replayBody // nil unless recording a request with a body
+
+	control *teeWriter // set once the control starts serving the request
+}
+
+// request returns a copy of the request. When recording, its body reads the
+// whole request body from the start, so that each handler sees the whole
+// body.
+func (x *served) request() *http.Request {
+	r := x.r.Clone(x.r.Context())
+	if x.body != nil {
+		r.Body = x.body.reader()
+	}
+	return r
+}
+
+// Handler returns an http.Handler that serves each request with both control
+// and candidate, as an experiment named name, and sends the control's
+// response to the client. The control writes straight to the client, as it
+// would without the experiment, so streaming, flushing, trailers and
+// hijacking work as usual. On runs in which the candidate runs, what the
+// control writes is also recorded for the comparison, and the candidate
+// writes to an httptest.ResponseRecorder only. The status codes, headers,
+// and bodies are compared as Responses with the experiment's Comparator,
+// DeepEqual by default.
+//
+// On those runs, the request body is read as the handlers ask for it, and
+// what has been read is kept, for as long as the request, so that the other
+// handler sees the same body, including any error reading it. On runs
+// without the candidate, nothing is kept: the control reads the request body
+// itself, and its Response in any published result has a nil Body. Handler
+// uses the experiment's InputCloner to tell the runs apart, so one set with
+// opts is replaced.
+//
+// Any further configuration, such as Publish or Enabled, can be applied with
+// opts. If the candidate is not run, only the control serves the request, as
+// it does if the experiment cannot run at all, for example because its
+// ComparatorName is not registered. If RecoverControl is set and the control
+// panics before writing anything, the client is sent a 500 Internal Server
+// Error. As the control's response has already been sent, ReturnCandidate
+// and ReturnFaster have no effect. In Shadow mode, the candidate may run
+// after the client has its response, by which time the request's context
+// has been cancelled; the rest of the request body is read once the control
+// is done, so that the candidate can still read it.
+func Handler(name string, control, candidate http.Handler, opts ...science.Option) http.Handler {
+	e := science.NewExperiment(name, opts...)
+	e.InputCloner = func(in interface{}) interface{} {
+		x := in.(*served)
+		x.record = true
+		if hasBody(x.r) {
+			x.body = &replayBody{src: x.r.Body}
+		}
+		return x
+	}
+	e.ControlFn = func(in interface{}) interface{} {
+		x := in.(*served)
+		x.control = &teeWriter{w: x.w}
+		if x.record {
+			x.control.rec = httptest.NewRecorder()
+		}
+		control.ServeHTTP(x.control, x.request())
+		if e.Shadow && x.body != nil {
+			x.body.fill()
+		}
+		return x.control.response()
+	}
+	e.CandidateFn = func(in interface{}) interface{} {
+		x := in.(*served)
+		rec := httptest.NewRecorder()
+		for k, v := range x.header {
+			rec.Header()[k] = v
+		}
+		candidate.ServeHTTP(rec, x.request())
+		return recorded(rec)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		x := &served{w: w, r: r, header: w.Header().Clone()}
+		v, _ := e.RunWith(x)
+		switch {
+		case x.control == nil:
+			// The experiment could not run, so serve the request without it.
+			control.ServeHTTP(w, x.request())
+		case v == nil && !x.control.sent:
+			// RecoverControl recovered a panic in the control.
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+	})
+}
+
+// recorded returns the response written to rec.
+func recorded(rec *httptest.ResponseRecorder) *Response {
+	res := rec.Result()
+	return &Response{
+		Status: res.StatusCode,
+		Header: res.Header,
+		Body:   rec.Body.Bytes(),
+	}
+}
+
+// teeWriter passes the control's response on to the client's ResponseWriter,
+// recording it as it goes if rec is set.
+type teeWriter struct {
+	w    http.ResponseWriter
+	rec  *httptest.ResponseRecorder // nil unless the candidate runs
+	code int                        // the status code, once sent
+	sent bool                       // whether the status code has been sent
+}
+
+func (t *teeWriter) Header() http.Header {
+	return t.w.Header()
+}
+
+func (t *teeWriter) WriteHeader(code int) {
+	t.syncHeader()
+	if code >= 200 {
+		t.markSent(code)
+	}
+	if t.rec != nil {
+		t.rec.WriteHeader(code)
+	}
+	t.w.WriteHeader(code)
+}
+
+func (t *teeWriter) Write(b []byte) (int, error) {
+	t.syncHeader()
+	t.markSent(http.StatusOK)
+	if t.rec != nil {
+		t.rec.Write(b)
+	}
+	return t.w.Write(b)
+}
+
+// Flush sends any buffered data to the client, if its ResponseWriter can.
+func (t *teeWriter) Flush() {
+	t.syncHeader()
+	t.markSent(http.StatusOK)
+	if t.rec != nil {
+		t.rec.Flush()
+	}
+	http.NewResponseController(t.w).Flush()
+}
+
+// Hijack lets the control take over the connection, if the client's
+// ResponseWriter allows it. Nothing written to the connection is recorded.
+func (t *teeWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(t.w).Hijack()
+}
+
+// Unwrap returns the client's ResponseWriter, for http.ResponseController.
+func (t *teeWriter) Unwrap() http.ResponseWriter {
+	return t.w
+}
+
+// syncHeader copies the header the control has set into the recorder, until
+// the status code has been sent and the recorder has taken its snapshot.
+func (t *teeWriter) syncHeader() {
+	if t.sent || t.rec == nil {
+		return
+	}
+	h := t.rec.Header()
+	for k := range h {
+		delete(h, k)
+	}
+	for k, v := range t.w.Header() {
+		h[k] = v
+	}
+}
+
+// markSent records that the status code has been sent, if it has not been
+// already.
+func (t *teeWriter) markSent(code int) {
+	if !t.sent {
+		t.sent = true
+		t.code = code
+	}
+}
+
+// response returns the control's recorded response, or, if it was not
+// recorded, only its status code and header.
+func (t *teeWriter) response() *Response {
+	if t.rec != nil {
+		return recorded(t.rec)
+	}
+	code := t.code
+	if code == 0 {
+		code = http.StatusOK
+	}
+	return &Response{Status: code, Header: t.w.Header().Clone()}
+}
+
+// replayBody reads a request body once for both handlers, keeping what has
+// been read so that each can read the whole body through its own reader.
+type replayBody struct {
+	mu  sync.Mutex
+	src io.Reader
+	buf []byte
+	err error // the error that ended src, once it has
+}
+
+func (b *replayBody) reader() io.ReadCloser {
+	return &replayReader{b: b}
+}
+
+// fill reads the rest of the body.
+func (b *replayBody) fill() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return
+	}
+	rest, err := io.ReadAll(b.src)
+	b.buf = append(b.buf, rest...)
+	b.err = err
+	if err == nil {
+		b.err = io.EOF
+	}
+}
+
+// replayReader reads a replayBody from the start, reading more of the body
+// only once it has caught up with what has already been read.
+type replayReader struct {
+	b   *replayBody
+	off int
+}
+
+func (r *replayReader) Read(p []byte) (int, error) {
+	b := r.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if r.off == len(b.buf) && b.err == nil {
+		n, err := b.src.Read(p)
+		b.buf = append(b.buf, p[:n]...)
+		b.err = err
+	}
+	if r.off < len(b.buf) {
+		n := copy(p, b.buf[r.off:])
+		r.off += n
+		return n, nil
+	}
+	return 0, b.err
+}
+
+// Close does nothing; the server closes the request body.
+func (r *replayReader) Close() error {
+	return nil
+}
@@ -0,0 +1,221 @@
+package httpx
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rubyist/science"
+)
+
+func echo(prefix string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Branch", prefix)
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, prefix+string(body))
+	})
+}
+
+func TestHandler(t *testing.T) {
+	var result *science.Result
+	h := Handler("echo", echo("a:"), echo("a:"), science.WithPublish(func(r *science.Result) { result = r }))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/", strings.NewReader("hello")))
+
+	if w.Code != http.StatusCreated || w.Body.String() != "a:hello" || w.Header().Get("X-Branch") != "a:" {
+		t.Fatalf("expected the control's response, got %d %q", w.Code, w.Body)
+	}
+
+	if result == nil || !result.Matched {
+		t.Fatal("expected both handlers to see the whole body and match")
+	}
+}
+
+func TestHandlerMismatch(t *testing.T) {
+	var result *science.Result
+	h := Handler("echo", echo("a:"), echo("b:"), science.WithPublish(func(r *science.Result) { result = r }))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/", strings.NewReader("hello")))
+
+	if w.Body.String() != "a:hello" {
+		t.Fatalf("expected the control's response, got %q", w.Body)
+	}
+	if result.Matched {
+		t.Fatal("expected different responses to mismatch")
+	}
+
+	candidate := result.Candidate.Value.(*Response)
+	if candidate.Status != http.StatusCreated || string(candidate.Body) != "b:hello" || candidate.Header.Get("X-Branch") != "b:" {
+		t.Fatalf("expected the candidate's response in the result, got %+v", candidate)
+	}
+}
+
+func TestHandlerBodyError(t *testing.T) {
+	failing := errors.New("connection reset")
+	seen := map[string]error{}
+	reader := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := io.ReadAll(r.Body)
+			seen[name] = err
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(body)
+		})
+	}
+
+	var result *science.Result
+	r := httptest.NewRequest("POST", "/", io.NopCloser(io.MultiReader(strings.NewReader("x"), errReader{failing})))
+	w := httptest.NewRecorder()
+	Handler("body", reader("control"), reader("candidate"), science.WithPublish(func(r *science.Result) { result = r })).ServeHTTP(w, r)
+
+	if seen["control"] != failing || w.Code != http.StatusBadRequest || w.Body.String() != "x" {
+		t.Fatal("expected the control to see the body error")
+	}
+	if seen["candidate"] != failing || !result.Matched {
+		t.Fatal("expected the candidate to see the same body and error")
+	}
+}
+
+// hijacker is a ResponseWriter that can be hijacked.
+type hijacker struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+}
+
+func (h *hijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h.hijacked = true
+	return nil, nil, nil
+}
+
+func TestHandlerServesControlDirectly(t *testing.T) {
+	streaming := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "event")
+		w.(http.Flusher).Flush()
+		// Only the client's connection can be hijacked, not the candidate's
+		// recorder.
+		http.NewResponseController(w).Hijack()
+	})
+
+	for _, enabled := range []bool{true, false} {
+		var result *science.Result
+		on := func(e *science.Experiment) {
+			e.Enabled = func() bool { return enabled }
+			e.Publish = func(r *science.Result) { result = r }
+		}
+		w := &hijacker{ResponseRecorder: httptest.NewRecorder()}
+		w.Header().Set("X-Middleware", "1")
+		Handler("stream", streaming, streaming, on).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+		if !w.Flushed || !w.hijacked || w.Body.String() != "event" {
+			t.Fatalf("expected the control to flush and hijack the client's connection (enabled: %v)", enabled)
+		}
+		if enabled && (result == nil || !result.Matched) {
+			t.Fatal("expected the recorded control response to match the candidate's")
+		}
+	}
+}
+
+// closingBody is a request body that cannot be read once closed, as the
+// server closes it when the handler returns.
+type closingBody struct {
+	io.Reader
+	closed bool
+}
+
+func (b *closingBody) Read(p []byte) (int, error) {
+	if b.closed {
+		return 0, errors.New("read on closed body")
+	}
+	return b.Reader.Read(p)
+}
+
+func (b *closingBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestHandlerShadowReadsWholeBody(t *testing.T) {
+	ignoring := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	results := make(chan *science.Result, 1)
+	shadow := func(e *science.Experiment) {
+		e.Shadow = true
+		e.Publish = func(r *science.Result) { results <- r }
+	}
+	h := Handler("shadow", ignoring, echo("b:"), shadow)
+
+	body := &closingBody{Reader: strings.NewReader("hello")}
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/", body))
+	body.Close()
+
+	select {
+	case r := <-results:
+		if got := string(r.Candidate.Value.(*Response).Body); got != "b:hello" {
+			t.Fatalf("expected the candidate to read the whole body, got %q", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected a result once the candidate finished")
+	}
+}
+
+func TestHandlerSkippedRunRecordsNothing(t *testing.T) {
+	body := io.NopCloser(strings.NewReader("hello"))
+	var seen io.ReadCloser
+	control := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Body
+		w.WriteHeader(http.StatusAccepted)
+		io.Copy(w, r.Body)
+	})
+
+	var result *science.Result
+	skipped := func(e *science.Experiment) {
+		e.Enabled = func() bool { return false }
+		e.AlwaysPublish = true
+		e.Publish = func(r *science.Result) { result = r }
+	}
+	w := httptest.NewRecorder()
+	Handler("skipped", control, echo("b:"), skipped).ServeHTTP(w, httptest.NewRequest("POST", "/", body))
+
+	if seen != body || w.Code != http.StatusAccepted || w.Body.String() != "hello" {
+		t.Fatal("expected the control to read the request body itself and serve the client")
+	}
+	res := result.Control.Value.(*Response)
+	if result.Candidate != nil || res.Status != http.StatusAccepted || res.Body != nil {
+		t.Fatalf("expected only the control's status to be kept, got %+v", res)
+	}
+}
+
+func TestHandlerServesControlWhenExperimentFails(t *testing.T) {
+	misconfigured := func(e *science.Experiment) { e.ComparatorName = "unregistered" }
+	h := Handler("echo", echo("a:"), echo("b:"), misconfigured)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/", strings.NewReader("hello")))
+
+	if w.Code != http.StatusCreated || w.Body.String() != "a:hello" {
+		t.Fatalf("expected the control to serve the whole request, got %d %q", w.Code, w.Body)
+	}
+}
+
+func TestHandlerRecoveredControlPanic(t *testing.T) {
+	control := http.HandlerFunc(func(http.ResponseWriter, *http.Request) { panic("handler broke") })
+	recovering := func(e *science.Experiment) {
+		e.RecoverControl = true
+		e.Publish = func(*science.Result) {}
+	}
+	h := Handler("panic", control, echo("b:"), recovering)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected a recovered control panic to be a server error, got %d", w.Code)
+	}
+}
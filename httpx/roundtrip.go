@@ -0,0 +1,210 @@
+package httpx
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/rubyist/science"
+)
+
+// exchange is a request and its buffered body.
+type exchange struct {
+	r    *http.Request
+	body []byte
+}
+
+// request returns a copy of the request whose body reads the buffered body
+// from the start.
+func (x *exchange) request() *http.Request {
+	r := x.r.Clone(x.r.Context())
+	r.Body = io.NopCloser(bytes.NewReader(x.body))
+	return r
+}
+
+// trip is the input of each branch of a RoundTripper experiment: the request,
+// its buffered body, and the responses the branches received.
+type trip struct {
+	exchange
+
+	mu           sync.Mutex
+	responses    map[*Response]*http.Response
+	candidateRan bool      // whether the candidate has started
+	pending      *Response // the control's response, until its body is buffered
+}
+
+// send returns a copy of the request to send, with the buffered body.
+func (t *trip) send() *http.Request {
+	r := t.request()
+	if hasBody(t.r) {
+		r.ContentLength = int64(len(t.body))
+		r.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(t.body)), nil
+		}
+	} else {
+		r.Body = t.r.Body
+	}
+	return r
+}
+
+// roundTripControl sends the request with the control's rt, returning the
+// *Response to compare, or the error if the request failed. The response
+// body is only buffered once the candidate runs, or straight away if buffer
+// is set, so that a run without the candidate leaves it to stream to the
+// caller as it would have.
+func (t *trip) roundTripControl(rt http.RoundTripper, buffer bool) interface{} {
+	res, err := rt.RoundTrip(t.send())
+	if err != nil {
+		return err
+	}
+
+	v := &Response{Status: res.StatusCode, Header: res.Header}
+	t.mu.Lock()
+	t.responses[v] = res
+	buffer = buffer || t.candidateRan
+	if !buffer {
+		t.pending = v
+	}
+	t.mu.Unlock()
+
+	if buffer {
+		bufferBody(v, res)
+	}
+	return v
+}
+
+// roundTripCandidate sends the request with the candidate's rt and buffers
+// the response, returning the *Response to compare, or the error if the
+// request or reading the response body failed. If the control has already
+// run, its response body is buffered first.
+func (t *trip) roundTripCandidate(rt http.RoundTripper) interface{} {
+	t.mu.Lock()
+	t.candidateRan = true
+	pending := t.pending
+	t.pending = nil
+	control := t.responses[pending]
+	t.mu.Unlock()
+	if pending != nil {
+		bufferBody(pending, control)
+	}
+
+	res, err := rt.RoundTrip(t.send())
+	if err != nil {
+		return err
+	}
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	v := &Response{Status: res.StatusCode, Header: res.Header, Body: body}
+
+	t.mu.Lock()
+	t.responses[v] = res
+	t.mu.Unlock()
+	return v
+}
+
+// bufferBody reads the body of res into v, replacing it with a reader that
+// replays what was read, followed by the error reading it, if there was one.
+func bufferBody(v *Response, res *http.Response) {
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	v.Body = body
+	if err != nil {
+		res.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), errReader{err}))
+		return
+	}
+	res.Body = io.NopCloser(bytes.NewReader(body))
+}
+
+// response returns the http.Response behind v, the value returned by the
+// experiment named name.
+func (t *trip) response(name string, v interface{}) (*http.Response, error) {
+	switch v := v.(type) {
+	case error:
+		return nil, v
+	case *Response:
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		return t.responses[v], nil
+	}
+	// RecoverControl recovered a panic in the control.
+	return nil, fmt.Errorf("httpx: experiment %q: control panicked", name)
+}
+
+// RoundTripper returns an http.RoundTripper that sends each request with both
+// control and candidate, as an experiment named name, and returns the
+// control's response, for shadow testing a new HTTP client or downstream
+// endpoint. The request body is read in full first, so that each branch
+// sends the whole body. When the candidate runs, each branch's response body
+// is read in full before the responses are compared as Responses with the
+// experiment's Comparator, DeepEqual by default; the caller then reads the
+// control's body from memory, and an error reading it is returned from the
+// body's Read, after the part that was read. When the candidate does not
+// run, the control's response is returned untouched, and its Response in any
+// published result has a nil Body.
+//
+// A branch whose request fails has the error as its value, so a candidate
+// that cannot connect is a mismatch, while its error never reaches the
+// caller; the control's errors are returned from RoundTrip as usual. If the
+// experiment cannot run at all, for example because its ComparatorName is
+// not registered, the request is sent with control alone, and if
+// RecoverControl is set and the control panics, RoundTrip returns an error.
+// As with Handler, any further configuration can be applied with opts. In
+// Shadow mode, the candidate's request may still be in flight after the
+// control's response has been returned, so the control's body is always read
+// in full first.
+func RoundTripper(name string, control, candidate http.RoundTripper, opts ...science.Option) http.RoundTripper {
+	e := science.NewExperiment(name, opts...)
+	e.ControlFn = func(in interface{}) interface{} { return in.(*trip).roundTripControl(control, e.Shadow) }
+	e.CandidateFn = func(in interface{}) interface{} { return in.(*trip).roundTripCandidate(candidate) }
+
+	return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		var body []byte
+		if hasBody(r) {
+			var err error
+			body, err = io.ReadAll(r.Body)
+			r.Body.Close()
+			if err != nil {
+				// Leave the control to send the broken body as it would have,
+				// without modifying the caller's request.
+				r = r.Clone(r.Context())
+				r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), errReader{err}))
+				return control.RoundTrip(r)
+			}
+		}
+
+		t := &trip{exchange: exchange{r: r, body: body}, responses: make(map[*Response]*http.Response)}
+		v, err := e.RunWith(t)
+		if v == nil && err != nil {
+			// The experiment could not run, so send the request without it.
+			return control.RoundTrip(t.send())
+		}
+		return t.response(name, v)
+	})
+}
+
+func hasBody(r *http.Request) bool {
+	return r.Body != nil && r.Body != http.NoBody
+}
+
+// roundTripperFunc adapts a function to http.RoundTripper.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// errReader returns err from every Read.
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
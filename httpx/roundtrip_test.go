@@ -0,0 +1,187 @@
+package httpx
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/rubyist/science"
+)
+
+// transport returns a RoundTripper that answers every request with its body,
+// prefixed by prefix.
+func transport(prefix string) http.RoundTripper {
+	return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		var body []byte
+		if r.Body != nil {
+			body, _ = io.ReadAll(r.Body)
+			r.Body.Close()
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"X-Branch": {prefix}},
+			Body:       io.NopCloser(strings.NewReader(prefix + string(body))),
+			Request:    r,
+		}, nil
+	})
+}
+
+func TestRoundTripper(t *testing.T) {
+	var result *science.Result
+	rt := RoundTripper("echo", transport("a:"), transport("a:"), science.WithPublish(func(r *science.Result) { result = r }))
+
+	req, _ := http.NewRequest("POST", "http://example.com/", strings.NewReader("hello"))
+	res, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := io.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK || string(body) != "a:hello" || res.Header.Get("X-Branch") != "a:" {
+		t.Fatalf("expected the control's response, got %d %q", res.StatusCode, body)
+	}
+
+	if result == nil || !result.Matched {
+		t.Fatal("expected both transports to send the whole body and match")
+	}
+
+	req, _ = http.NewRequest("GET", "http://example.com/", nil)
+	if _, err := rt.RoundTrip(req); err != nil || !result.Matched {
+		t.Fatalf("expected a request without a body to be sent, got %v", err)
+	}
+}
+
+func TestRoundTripperBuffersControlOnlyWithCandidate(t *testing.T) {
+	var sent io.ReadCloser
+	streaming := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		sent = io.NopCloser(strings.NewReader("stream"))
+		return &http.Response{StatusCode: http.StatusOK, Body: sent, Request: r}, nil
+	})
+
+	disabled := func(e *science.Experiment) { e.Enabled = func() bool { return false } }
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	res, err := RoundTripper("stream", streaming, transport("b:"), disabled).RoundTrip(req)
+	if err != nil || res.Body != sent {
+		t.Fatal("expected the control's body to be returned unread when the candidate does not run")
+	}
+
+	defer science.ClearDeterministicOrder()
+	for _, controlFirst := range []bool{true, false} {
+		science.SetDeterministicOrder(controlFirst)
+		var result *science.Result
+		rt := RoundTripper("echo", transport("a:"), transport("a:"), science.WithPublish(func(r *science.Result) { result = r }))
+
+		req, _ := http.NewRequest("POST", "http://example.com/", strings.NewReader("hello"))
+		res, err := rt.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if body, _ := io.ReadAll(res.Body); string(body) != "a:hello" || !result.Matched {
+			t.Fatalf("expected the control's buffered body to be compared and returned (control first: %v), got %q", controlFirst, body)
+		}
+	}
+}
+
+func TestRoundTripperControlBodyError(t *testing.T) {
+	failing := errors.New("connection reset")
+	broken := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		body := io.NopCloser(io.MultiReader(strings.NewReader("a:"), errReader{failing}))
+		return &http.Response{StatusCode: http.StatusOK, Body: body, Request: r}, nil
+	})
+
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	res, err := RoundTripper("broken", broken, transport("a:")).RoundTrip(req)
+	if err != nil {
+		t.Fatalf("expected the control's body error not to be returned from RoundTrip, got %v", err)
+	}
+	if body, err := io.ReadAll(res.Body); string(body) != "a:" || err != failing {
+		t.Fatalf("expected the body read so far and then the error, got %q, %v", body, err)
+	}
+}
+
+func TestRoundTripperCandidateError(t *testing.T) {
+	failing := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		return nil, errors.New("connection refused")
+	})
+
+	var result *science.Result
+	rt := RoundTripper("echo", transport("a:"), failing, science.WithPublish(func(r *science.Result) { result = r }))
+
+	req, _ := http.NewRequest("POST", "http://example.com/", strings.NewReader("hello"))
+	res, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("expected the candidate's error not to reach the caller, got %v", err)
+	}
+	if body, _ := io.ReadAll(res.Body); string(body) != "a:hello" {
+		t.Fatalf("expected the control's response, got %q", body)
+	}
+
+	if result.Matched {
+		t.Fatal("expected a failed candidate to mismatch")
+	}
+	if err, ok := result.Candidate.Value.(error); !ok || err.Error() != "connection refused" {
+		t.Fatalf("expected the candidate's error in the result, got %v", result.Candidate.Value)
+	}
+
+	rt = RoundTripper("echo", failing, transport("a:"))
+	if _, err := rt.RoundTrip(req); err == nil || err.Error() != "connection refused" {
+		t.Fatalf("expected the control's error to be returned, got %v", err)
+	}
+}
+
+func TestRoundTripperBodyError(t *testing.T) {
+	failing := errors.New("connection reset")
+	candidateRan := false
+	candidate := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		candidateRan = true
+		return nil, nil
+	})
+
+	rt := RoundTripper("echo", transport("a:"), candidate)
+	req, _ := http.NewRequest("POST", "http://example.com/", io.MultiReader(strings.NewReader("hel"), errReader{failing}))
+	body := req.Body
+
+	res, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := io.ReadAll(res.Body); string(b) != "a:hel" {
+		t.Fatalf("expected the control to see the body read so far, got %q", b)
+	}
+	if candidateRan {
+		t.Fatal("expected the candidate not to run when the body cannot be read")
+	}
+	if req.Body != body {
+		t.Fatal("expected the caller's request not to be modified")
+	}
+}
+
+func TestRoundTripperSendsWithControlWhenExperimentFails(t *testing.T) {
+	misconfigured := func(e *science.Experiment) { e.ComparatorName = "unregistered" }
+	rt := RoundTripper("echo", transport("a:"), transport("b:"), misconfigured)
+
+	req, _ := http.NewRequest("POST", "http://example.com/", strings.NewReader("hello"))
+	res, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := io.ReadAll(res.Body); string(body) != "a:hello" {
+		t.Fatalf("expected the control to send the whole request, got %q", body)
+	}
+}
+
+func TestRoundTripperRecoveredControlPanic(t *testing.T) {
+	control := roundTripperFunc(func(*http.Request) (*http.Response, error) { panic("transport broke") })
+	recovering := func(e *science.Experiment) {
+		e.RecoverControl = true
+		e.Publish = func(*science.Result) {}
+	}
+	rt := RoundTripper("panic", control, transport("b:"), recovering)
+
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	if res, err := rt.RoundTrip(req); res != nil || err == nil {
+		t.Fatalf("expected a recovered control panic to be an error, got %v", err)
+	}
+}
@@ -0,0 +1,29 @@
+package science
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"sync/atomic"
+)
+
+// idPrefix distinguishes result IDs generated by this process from those of
+// other processes, so IDs are unique across a fleet and not just within one
+// process.
+var idPrefix = randomPrefix()
+
+var idCounter atomic.Uint64
+
+func randomPrefix() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic("science: generating result ID prefix: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
+
+// newResultID returns an ID for a Result, made of the process's random
+// prefix and a counter incremented for every run.
+func newResultID() string {
+	return idPrefix + "-" + strconv.FormatUint(idCounter.Add(1), 10)
+}
@@ -0,0 +1,32 @@
+package science
+
+import "testing"
+
+func TestExperimentResultIDs(t *testing.T) {
+	e := NewExperiment("test")
+	e.Control = func() interface{} { return 1 }
+	e.Candidate = func() interface{} { return 1 }
+	e.AlwaysPublish = true
+
+	seen := map[string]bool{}
+	e.Publish = func(r *Result) {
+		if r.ID == "" {
+			t.Fatal("expected every result to have an ID")
+		}
+		if seen[r.ID] {
+			t.Fatalf("expected result IDs to be unique, got %q twice", r.ID)
+		}
+		seen[r.ID] = true
+	}
+
+	e.Run()
+	e.Run()
+
+	e.Pause()
+	e.Run()
+	e.Resume()
+
+	if len(seen) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(seen))
+	}
+}
@@ -0,0 +1,26 @@
+package science
+
+import "reflect"
+
+// Float is the constraint satisfied by floating point types, for
+// NewNumericExperiment.
+type Float interface {
+	~float32 | ~float64
+}
+
+// NewNumericExperiment creates an experiment, as NewExperiment does, for
+// branches that return floating point values of type T. Its Comparator is
+// NumericComparator with epsilon as the tolerance, and its ExpectedType is T,
+// so a branch returning any other type is reported as a TypeMismatch rather
+// than compared. Options are applied after these are set, so they can still
+// be overridden.
+func NewNumericExperiment[T Float](name string, epsilon T, opts ...Option) *Experiment {
+	e := NewExperiment(name)
+	e.captureCaller(1)
+	e.Comparator = NumericComparator(float64(epsilon))
+	e.ExpectedType = reflect.TypeOf(T(0))
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
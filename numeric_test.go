@@ -0,0 +1,27 @@
+package science
+
+import "testing"
+
+func TestNewNumericExperiment(t *testing.T) {
+	var result *Result
+	e := NewNumericExperiment("sum", 0.01, WithPublish(func(r *Result) { result = r }))
+	e.Control = func() interface{} { return 0.1 + 0.2 }
+	e.Candidate = func() interface{} { return 0.305 }
+
+	e.Run()
+	if !result.Matched {
+		t.Fatal("expected values within epsilon to match")
+	}
+
+	e.Candidate = func() interface{} { return 0.32 }
+	e.Run()
+	if result.Matched {
+		t.Fatal("expected values further apart than epsilon to mismatch")
+	}
+
+	e.Candidate = func() interface{} { return float32(0.3) }
+	e.Run()
+	if !result.TypeMismatch {
+		t.Fatal("expected a value of another type to be a type mismatch")
+	}
+}
@@ -0,0 +1,81 @@
+package science
+
+import (
+	"fmt"
+)
+
+// An Option configures an Experiment when it is created with NewExperiment or
+// MustExperiment.
+type Option func(*Experiment)
+
+// WithControl sets the experiment's Control.
+func WithControl(f ExperimentFunc) Option {
+	return func(e *Experiment) { e.Control = f }
+}
+
+// WithCandidate sets the experiment's Candidate.
+func WithCandidate(f ExperimentFunc) Option {
+	return func(e *Experiment) { e.Candidate = f }
+}
+
+// WithControlFn sets the experiment's ControlFn.
+func WithControlFn(f InputFunc) Option {
+	return func(e *Experiment) { e.ControlFn = f }
+}
+
+// WithCandidateFn sets the experiment's CandidateFn.
+func WithCandidateFn(f InputFunc) Option {
+	return func(e *Experiment) { e.CandidateFn = f }
+}
+
+// WithComparator sets the experiment's Comparator.
+func WithComparator(f ComparatorFunc) Option {
+	return func(e *Experiment) { e.Comparator = f }
+}
+
+// WithEnabled sets the experiment's Enabled function.
+func WithEnabled(f EnabledFunc) Option {
+	return func(e *Experiment) { e.Enabled = f }
+}
+
+// WithPublish sets the experiment's Publish function.
+func WithPublish(f PublishFunc) Option {
+	return func(e *Experiment) { e.Publish = f }
+}
+
+// WithLogger sets the experiment's Logger.
+func WithLogger(l Logger) Option {
+	return func(e *Experiment) { e.Logger = l }
+}
+
+// MustExperiment creates an Experiment like NewExperiment, but panics if the
+// options leave it unable to run: it needs a Comparator or DefaultComparator,
+// and a Control and Candidate, or a ControlFn and CandidateFn. It is intended
+// for wiring up experiments at startup, so that misconfiguration is caught
+// immediately.
+func MustExperiment(name string, opts ...Option) *Experiment {
+	e := NewExperiment(name, opts...)
+	e.captureCaller(1)
+	if err := e.validate(); err != nil {
+		panic(fmt.Sprintf("science: experiment %q: %v", name, err))
+	}
+	return e
+}
+
+// validate checks that the experiment can be run by at least one of RunValue
+// and RunWith.
+func (e *Experiment) validate() error {
+	if e.Control == nil && e.ControlFn == nil {
+		return ErrNoControl
+	}
+	if e.BaselineOnly {
+		return nil
+	}
+	if (e.Control == nil || e.Candidate == nil) && (e.ControlFn == nil || e.CandidateFn == nil) {
+		return ErrNoCandidate
+	}
+	if e.comparator() == nil {
+		return ErrNoComparator
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package science
+
+import (
+	"testing"
+)
+
+func TestNewExperimentAppliesOptions(t *testing.T) {
+	var published bool
+
+	e := NewExperiment("test",
+		WithControl(func() interface{} { return 1 }),
+		WithCandidate(func() interface{} { return 1 }),
+		WithPublish(func(*Result) { published = true }))
+
+	if err := e.Run(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !published {
+		t.Fatal("expected the options to configure the experiment")
+	}
+}
+
+func TestMustExperiment(t *testing.T) {
+	f := func() interface{} { return nil }
+	fn := func(interface{}) interface{} { return nil }
+
+	MustExperiment("test", WithControl(f), WithCandidate(f))
+	MustExperiment("test", WithControlFn(fn), WithCandidateFn(fn))
+
+	for _, opts := range [][]Option{
+		{WithCandidate(f)},
+		{WithControl(f)},
+		{WithControl(f), WithCandidateFn(fn)},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("expected MustExperiment to panic")
+				}
+			}()
+			MustExperiment("test", opts...)
+		}()
+	}
+}
@@ -0,0 +1,103 @@
+package science
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultPercentileWindow is the number of recent durations kept for each
+// branch when an experiment's PercentileWindow is zero.
+const DefaultPercentileWindow = 100
+
+// DurationStats summarizes the recent durations of one branch of an
+// experiment.
+type DurationStats struct {
+	Count int           // Number of durations in the window
+	P50   time.Duration // Median duration
+	P95   time.Duration // 95th percentile duration
+}
+
+// Percentiles returns duration statistics for the control and candidate over
+// the most recent PercentileWindow runs in which both were observed. Warmup
+// runs are not included.
+func (e *Experiment) Percentiles() (control, candidate DurationStats) {
+	e.durations.Lock()
+	defer e.durations.Unlock()
+	return e.durations.control.stats(), e.durations.candidate.stats()
+}
+
+// durationWindows holds the recent durations of each branch.
+type durationWindows struct {
+	sync.Mutex
+	control   durationRing
+	candidate durationRing
+}
+
+func (w *durationWindows) add(size int, control, candidate time.Duration) {
+	if size <= 0 {
+		size = DefaultPercentileWindow
+	}
+
+	w.Lock()
+	defer w.Unlock()
+	w.control.add(size, control)
+	w.candidate.add(size, candidate)
+}
+
+func (w *durationWindows) reset() {
+	w.Lock()
+	defer w.Unlock()
+	w.control = durationRing{}
+	w.candidate = durationRing{}
+}
+
+// durationRing is a bounded buffer which overwrites its oldest duration once
+// full.
+type durationRing struct {
+	buf  []time.Duration
+	next int
+}
+
+func (r *durationRing) add(size int, d time.Duration) {
+	if len(r.buf) != size && r.next != 0 {
+		// The window has been resized since the ring wrapped around, so put
+		// the durations back in order, oldest first.
+		r.buf = append(append([]time.Duration(nil), r.buf[r.next:]...), r.buf[:r.next]...)
+		r.next = 0
+	}
+	if len(r.buf) < size {
+		r.buf = append(r.buf, d)
+		return
+	}
+	if len(r.buf) > size {
+		r.buf = r.buf[len(r.buf)-size:]
+	}
+	r.buf[r.next] = d
+	r.next = (r.next + 1) % size
+}
+
+func (r *durationRing) stats() DurationStats {
+	if len(r.buf) == 0 {
+		return DurationStats{}
+	}
+
+	sorted := append([]time.Duration(nil), r.buf...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	return DurationStats{
+		Count: len(sorted),
+		P50:   percentile(sorted, 0.50),
+		P95:   percentile(sorted, 0.95),
+	}
+}
+
+// percentile returns the nearest-rank percentile p of the sorted durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
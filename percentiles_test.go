@@ -0,0 +1,66 @@
+package science
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDurationRing(t *testing.T) {
+	var r durationRing
+	for i := 1; i <= 30; i++ {
+		r.add(20, time.Duration(i))
+	}
+
+	stats := r.stats()
+	if stats.Count != 20 {
+		t.Fatalf("expected the window to be bounded to 20, got %d", stats.Count)
+	}
+
+	// The window holds 11 through 30.
+	if stats.P50 != 20 {
+		t.Fatalf("expected p50 of 20, got %d", stats.P50)
+	}
+
+	if stats.P95 != 29 {
+		t.Fatalf("expected p95 of 29, got %d", stats.P95)
+	}
+}
+
+func TestDurationRingResize(t *testing.T) {
+	var r durationRing
+	for i := 1; i <= 7; i++ {
+		r.add(5, time.Duration(i))
+	}
+
+	// Shrinking keeps the newest durations: 6, 7, and then 8.
+	r.add(3, 8)
+	if stats := r.stats(); stats.Count != 3 || stats.P50 != 7 {
+		t.Fatalf("expected the newest durations to be kept, got %+v", stats)
+	}
+
+	// Growing again, then wrapping around, evicts the oldest first, leaving 8
+	// through 12.
+	for i := 9; i <= 11; i++ {
+		r.add(5, time.Duration(i))
+	}
+	r.add(5, 12)
+	if stats := r.stats(); stats.Count != 5 || stats.P50 != 10 {
+		t.Fatalf("expected the oldest duration to be overwritten, got %+v", stats)
+	}
+}
+
+func TestExperimentPercentiles(t *testing.T) {
+	e := NewExperiment("test")
+	e.Warmup = 1
+	e.Control = func() interface{} { return nil }
+	e.Candidate = func() interface{} { return nil }
+
+	for i := 0; i < 5; i++ {
+		e.Run()
+	}
+
+	control, candidate := e.Percentiles()
+	if control.Count != 4 || candidate.Count != 4 {
+		t.Fatalf("expected 4 non-warmup durations per branch, got %d and %d", control.Count, candidate.Count)
+	}
+}
@@ -0,0 +1,246 @@
+package science
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// BatchPublishFunc is a function that receives several results at once.
+type BatchPublishFunc func([]*Result)
+
+// BufferedPublisher collects results and passes them to a BatchPublishFunc
+// in batches, for destinations that handle batched writes more efficiently
+// than single ones. Its Publish method can be used as an experiment's
+// Publish function.
+type BufferedPublisher struct {
+	publish BatchPublishFunc
+	size    int
+
+	mu     sync.Mutex
+	buf    []*Result
+	closed bool
+
+	flushMu sync.Mutex // serializes calls to publish
+
+	quit chan struct{}
+	done chan struct{}
+}
+
+// NewBufferedPublisher returns a BufferedPublisher that passes results to
+// publish once size of them have been collected, and every interval if that
+// is positive. Close should be called to flush remaining results and stop the
+// interval timer; Shutdown closes any BufferedPublishers still open.
+func NewBufferedPublisher(publish BatchPublishFunc, size int, interval time.Duration) *BufferedPublisher {
+	p := &BufferedPublisher{
+		publish: publish,
+		size:    size,
+		quit:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	if interval > 0 {
+		go p.tick(interval)
+	} else {
+		close(p.done)
+	}
+
+	registerBuffered(p)
+	return p
+}
+
+// Publish adds the result to the current batch, flushing it if it is full.
+// The flush happens in the caller's goroutine. Results published after Close
+// are passed on immediately as a batch of one.
+func (p *BufferedPublisher) Publish(r *Result) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		p.send([]*Result{r})
+		return
+	}
+
+	p.buf = append(p.buf, r)
+	full := len(p.buf) >= p.size
+	p.mu.Unlock()
+
+	if full {
+		p.Flush()
+	}
+}
+
+// Flush passes any collected results on immediately.
+func (p *BufferedPublisher) Flush() {
+	p.mu.Lock()
+	batch := p.buf
+	p.buf = nil
+	p.mu.Unlock()
+
+	if len(batch) > 0 {
+		p.send(batch)
+	}
+}
+
+// Close stops the interval timer and flushes any collected results. It may
+// be called more than once.
+func (p *BufferedPublisher) Close() {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.quit)
+	}
+	p.mu.Unlock()
+
+	<-p.done
+	p.Flush()
+	unregisterBuffered(p)
+}
+
+func (p *BufferedPublisher) send(batch []*Result) {
+	p.flushMu.Lock()
+	defer p.flushMu.Unlock()
+	p.publish(batch)
+}
+
+func (p *BufferedPublisher) tick(interval time.Duration) {
+	defer close(p.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.quit:
+			return
+		case <-ticker.C:
+			p.Flush()
+		}
+	}
+}
+
+// ContextPublishFunc is a publisher for MultiPublish. It should give up when
+// ctx is done, and returns any error encountered.
+type ContextPublishFunc func(ctx context.Context, r *Result) error
+
+// ContextPublisher adapts a PublishFunc, such as the Publish method of an
+// Aggregator, to a ContextPublishFunc for MultiPublish. The context is
+// ignored, so MultiPublish's timeout can only abandon it, not stop it, and
+// it never returns an error.
+func ContextPublisher(publish PublishFunc) ContextPublishFunc {
+	return func(ctx context.Context, r *Result) error {
+		publish(r)
+		return nil
+	}
+}
+
+// MultiPublish returns a PublishFunc that sends each result to all of the
+// publishers concurrently and waits for them to finish. Each publisher is
+// given its own context derived from a context shared by the fan-out, which
+// is cancelled after timeout if it is positive; a publisher that has not
+// returned by then is abandoned, so a slow one cannot hold up the others.
+// Errors, panics, and timeouts are reported to logger, which may be nil.
+//
+// Set the experiment's Async field to keep the whole fan-out off the request
+// path.
+func MultiPublish(logger Logger, timeout time.Duration, publishers ...ContextPublishFunc) PublishFunc {
+	return func(r *Result) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var wg sync.WaitGroup
+		for i, publish := range publishers {
+			wg.Add(1)
+			go func(i int, publish ContextPublishFunc) {
+				defer wg.Done()
+				if err := publishWithin(ctx, timeout, publish, r); err != nil && logger != nil {
+					logger.Printf("science: experiment %q: publisher %d: %v", r.Name, i, err)
+				}
+			}(i, publish)
+		}
+		wg.Wait()
+	}
+}
+
+// publishWithin calls publish, returning its error, or the context's error if
+// timeout passes first.
+func publishWithin(parent context.Context, timeout time.Duration, publish ContextPublishFunc, r *Result) error {
+	ctx, cancel := parent, context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(parent, timeout)
+	}
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				done <- fmt.Errorf("panicked: %v", p)
+			}
+		}()
+		done <- publish(ctx, r)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ThrottledPublisher passes at most a fixed number of results per window of
+// time to another PublishFunc, dropping the rest, so that a candidate that
+// mismatches on every request cannot flood the destination. Its Publish
+// method can be used as an experiment's Publish function.
+type ThrottledPublisher struct {
+	publish PublishFunc
+	max     int
+	per     time.Duration
+	now     func() time.Time
+
+	mu      sync.Mutex
+	start   time.Time // start of the current window
+	sent    int       // results passed on in the current window
+	dropped int64
+}
+
+// NewThrottledPublisher returns a ThrottledPublisher that passes at most max
+// results to publish in each window of length per. Windows are consecutive
+// and fixed, the first starting with the first result published.
+func NewThrottledPublisher(publish PublishFunc, max int, per time.Duration) *ThrottledPublisher {
+	return &ThrottledPublisher{
+		publish: publish,
+		max:     max,
+		per:     per,
+		now:     time.Now,
+	}
+}
+
+// Publish passes the result on, unless max results have already been passed
+// on in the current window, in which case it is dropped.
+func (p *ThrottledPublisher) Publish(r *Result) {
+	p.mu.Lock()
+	now := p.now()
+	if p.start.IsZero() || now.Sub(p.start) >= p.per {
+		p.start = now
+		p.sent = 0
+	}
+
+	if p.sent >= p.max {
+		p.dropped++
+		p.mu.Unlock()
+		return
+	}
+	p.sent++
+	p.mu.Unlock()
+
+	p.publish(r)
+}
+
+// Dropped returns the number of results dropped so far.
+func (p *ThrottledPublisher) Dropped() int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.dropped
+}
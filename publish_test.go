@@ -0,0 +1,149 @@
+package science
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type batches struct {
+	mu  sync.Mutex
+	all [][]*Result
+}
+
+func (b *batches) publish(batch []*Result) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.all = append(b.all, batch)
+}
+
+func (b *batches) sizes() []int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var sizes []int
+	for _, batch := range b.all {
+		sizes = append(sizes, len(batch))
+	}
+	return sizes
+}
+
+func TestBufferedPublisherFlushesWhenFull(t *testing.T) {
+	b := &batches{}
+	p := NewBufferedPublisher(b.publish, 2, 0)
+
+	for i := 0; i < 5; i++ {
+		p.Publish(&Result{})
+	}
+
+	if sizes := b.sizes(); len(sizes) != 2 || sizes[0] != 2 || sizes[1] != 2 {
+		t.Fatalf("expected two full batches, got %v", sizes)
+	}
+
+	p.Close()
+	if sizes := b.sizes(); len(sizes) != 3 || sizes[2] != 1 {
+		t.Fatalf("expected Close to flush the remaining result, got %v", sizes)
+	}
+
+	p.Publish(&Result{})
+	if sizes := b.sizes(); len(sizes) != 4 {
+		t.Fatalf("expected results published after Close to be passed on, got %v", sizes)
+	}
+}
+
+func TestBufferedPublisherFlushesOnInterval(t *testing.T) {
+	b := &batches{}
+	p := NewBufferedPublisher(b.publish, 100, 5*time.Millisecond)
+	defer p.Close()
+
+	p.Publish(&Result{})
+
+	deadline := time.Now().Add(time.Second)
+	for len(b.sizes()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the batch to be flushed on the interval")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestMultiPublish(t *testing.T) {
+	logger := &testLogger{}
+
+	var mu sync.Mutex
+	var published []string
+	record := func(name string) ContextPublishFunc {
+		return func(ctx context.Context, r *Result) error {
+			mu.Lock()
+			defer mu.Unlock()
+			published = append(published, name)
+			return nil
+		}
+	}
+
+	slow := func(ctx context.Context, r *Result) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	ignoresContext := func(ctx context.Context, r *Result) error {
+		time.Sleep(time.Second)
+		return nil
+	}
+	failing := func(ctx context.Context, r *Result) error {
+		return errors.New("backend down")
+	}
+	panicking := func(ctx context.Context, r *Result) error {
+		panic("boom")
+	}
+
+	publish := MultiPublish(logger, 20*time.Millisecond,
+		record("logs"), slow, ignoresContext, failing, panicking, record("metrics"))
+
+	start := time.Now()
+	publish(&Result{Name: "test"})
+
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatal("expected slow publishers to be abandoned after the timeout")
+	}
+
+	mu.Lock()
+	if len(published) != 2 {
+		t.Fatalf("expected the healthy publishers to publish, got %v", published)
+	}
+	mu.Unlock()
+
+	if lines := logger.Lines(); len(lines) != 4 {
+		t.Fatalf("expected four publisher errors to be logged, got %v", lines)
+	}
+}
+
+func TestContextPublisher(t *testing.T) {
+	agg := NewAggregator(0)
+	MultiPublish(nil, time.Second, ContextPublisher(agg.Publish))(&Result{Name: "test", Compared: true, Matched: true})
+
+	if s := agg.Snapshot()["test"]; s.Runs != 1 {
+		t.Fatalf("expected the adapted publisher to receive the result, got %+v", s)
+	}
+}
+
+func TestThrottledPublisher(t *testing.T) {
+	published := 0
+	p := NewThrottledPublisher(func(r *Result) { published++ }, 2, time.Minute)
+
+	now := time.Now()
+	p.now = func() time.Time { return now }
+
+	for i := 0; i < 5; i++ {
+		p.Publish(&Result{})
+	}
+	if published != 2 || p.Dropped() != 3 {
+		t.Fatalf("expected 2 results passed on and 3 dropped, got %d and %d", published, p.Dropped())
+	}
+
+	now = now.Add(time.Minute)
+	p.Publish(&Result{})
+	if published != 3 {
+		t.Fatal("expected results to be passed on again in the next window")
+	}
+}
@@ -0,0 +1,53 @@
+package science
+
+import "sync"
+
+// QueryCounter reports the number of database queries issued so far, for
+// example by a hook in a database driver or ORM.
+type QueryCounter interface {
+	Queries() int64
+}
+
+// CountQueries sets the experiment's BeforeObserve and AfterObserve hooks to
+// record in each observation's Extra["queries"] the number of queries counter
+// counted while the branch ran, as an int64, so that a refactor can be
+// checked to make the same number of queries as well as return the same
+// result. Hooks already set are still called, the existing BeforeObserve
+// first and the existing AfterObserve last.
+//
+// The branches of one run are observed one after another, but runs in other
+// goroutines may share a counter. To count only the queries of one request,
+// scope the counter to the request, for example by keeping it in the
+// request's context, and create the experiment for the request with a
+// Template or Clone:
+//
+//	e := base.Clone()
+//	e.CountQueries(db.CounterFrom(ctx))
+//	e.Run()
+func (e *Experiment) CountQueries(counter QueryCounter) {
+	var mu sync.Mutex
+	starts := make(map[*Observation]int64)
+
+	before, after := e.BeforeObserve, e.AfterObserve
+	e.BeforeObserve = func(branch string, o *Observation) {
+		if before != nil {
+			before(branch, o)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		starts[o] = counter.Queries()
+	}
+	e.AfterObserve = func(branch string, o *Observation) {
+		mu.Lock()
+		start, ok := starts[o]
+		delete(starts, o)
+		mu.Unlock()
+
+		if ok {
+			o.Extra["queries"] = counter.Queries() - start
+		}
+		if after != nil {
+			after(branch, o)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package science
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+type testCounter struct {
+	n atomic.Int64
+}
+
+func (c *testCounter) Queries() int64 { return c.n.Load() }
+
+func TestExperimentCountQueries(t *testing.T) {
+	db := &testCounter{}
+	query := func(n int) {
+		for i := 0; i < n; i++ {
+			db.n.Add(1)
+		}
+	}
+
+	var seen []string
+	e := NewExperiment("test")
+	e.AfterObserve = func(branch string, o *Observation) { seen = append(seen, branch) }
+	e.Control = func() interface{} {
+		query(3)
+		return 1
+	}
+	e.Candidate = func() interface{} {
+		query(1)
+		return 1
+	}
+	e.CountQueries(db)
+
+	var result *Result
+	e.Publish = func(r *Result) { result = r }
+	e.Run()
+
+	if q := result.Control.Extra["queries"]; q != int64(3) {
+		t.Fatalf("expected the control's 3 queries, got %v", q)
+	}
+	if q := result.Candidate.Extra["queries"]; q != int64(1) {
+		t.Fatalf("expected the candidate's 1 query, got %v", q)
+	}
+	if len(seen) != 2 {
+		t.Fatal("expected the existing AfterObserve hook to still be called")
+	}
+}
@@ -0,0 +1,51 @@
+package science
+
+import "sync"
+
+// comparators holds the comparators registered by name.
+var comparators struct {
+	sync.RWMutex
+	byName map[string]ComparatorFunc
+}
+
+// RegisterComparator makes cmp available by name, for experiments configured
+// with ComparatorName, such as those loaded from a configuration file. It is
+// typically called from an init function. If RegisterComparator is called
+// twice with the same name or with a nil cmp, it panics.
+//
+// These comparators are registered by the package: "deep-equal",
+// "unordered-slice", "error", "values", "json-canonical", "big", and
+// "comparable".
+func RegisterComparator(name string, cmp ComparatorFunc) {
+	comparators.Lock()
+	defer comparators.Unlock()
+
+	if cmp == nil {
+		panic("science: RegisterComparator comparator is nil")
+	}
+	if _, dup := comparators.byName[name]; dup {
+		panic("science: RegisterComparator called twice for comparator " + name)
+	}
+	if comparators.byName == nil {
+		comparators.byName = make(map[string]ComparatorFunc)
+	}
+	comparators.byName[name] = cmp
+}
+
+// ComparatorByName returns the comparator registered as name, or nil if
+// there is none.
+func ComparatorByName(name string) ComparatorFunc {
+	comparators.RLock()
+	defer comparators.RUnlock()
+	return comparators.byName[name]
+}
+
+func init() {
+	RegisterComparator("deep-equal", DeepEqual)
+	RegisterComparator("unordered-slice", UnorderedSliceComparator)
+	RegisterComparator("error", ErrorComparator)
+	RegisterComparator("values", ValuesComparator)
+	RegisterComparator("json-canonical", JSONCanonicalComparator)
+	RegisterComparator("big", BigComparator)
+	RegisterComparator("comparable", ComparableComparator)
+}
@@ -0,0 +1,45 @@
+package science
+
+import "testing"
+
+func TestRegisterComparator(t *testing.T) {
+	RegisterComparator("test-always", func(a, b interface{}) bool { return true })
+	t.Cleanup(func() {
+		comparators.Lock()
+		defer comparators.Unlock()
+		delete(comparators.byName, "test-always")
+	})
+
+	if ComparatorByName("test-always") == nil || ComparatorByName("deep-equal") == nil {
+		t.Fatal("expected registered comparators to be found")
+	}
+	if ComparatorByName("missing") != nil {
+		t.Fatal("expected nil for an unregistered name")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected registering a name twice to panic")
+		}
+	}()
+	RegisterComparator("test-always", DeepEqual)
+}
+
+func TestExperimentComparatorName(t *testing.T) {
+	e := NewExperiment("test")
+	e.ComparatorName = "unordered-slice"
+	e.Control = func() interface{} { return []int{1, 2} }
+	e.Candidate = func() interface{} { return []int{2, 1} }
+
+	var result *Result
+	e.Publish = func(r *Result) { result = r }
+	e.Run()
+	if !result.Matched {
+		t.Fatal("expected the named comparator to be used in place of Comparator")
+	}
+
+	e.ComparatorName = "missing"
+	if err := e.Run(); err != ErrNoComparator {
+		t.Fatalf("expected ErrNoComparator for an unregistered name, got %v", err)
+	}
+}
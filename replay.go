@@ -0,0 +1,94 @@
+package science
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// Record is a captured production call: the input given to the control and
+// the output it returned.
+type Record struct {
+	Input  interface{}
+	Output interface{}
+}
+
+// Replay runs CandidateFn on the input of each record and compares its value
+// with the record's Output, which stands in for the control, as
+// RunAgainstGolden does with Golden. This validates a candidate against
+// captured traffic without running a control that may have side effects:
+// the control is never called. As with RunAgainstGolden, the candidate runs
+// whether or not the experiment is enabled, and the results are returned in
+// the order of the records as well as being published. The control
+// observations have zero durations. If CandidateFn is nil, every entry is
+// nil.
+func (e *Experiment) Replay(records []Record) []*Result {
+	results := make([]*Result, len(records))
+	if e.CandidateFn == nil {
+		return results
+	}
+
+	for i, r := range records {
+		r := r
+		recorded := func() interface{} { return r.Output }
+		candidate := func() interface{} { return e.CandidateFn(r.Input) }
+		_, results[i], _ = e.run(call{input: r.Input, golden: true}, recorded, candidate)
+	}
+	return results
+}
+
+// InputJSON returns the JSON encoding of the result's Input, for storing
+// alongside a published mismatch so that ReplayResult can reproduce it later.
+// As Input is recorded after CleanInput, anything CleanInput removes cannot
+// be replayed.
+func (r *Result) InputJSON() ([]byte, error) {
+	return json.Marshal(r.Input)
+}
+
+// ReplayResult runs the experiment again on the input captured in r, to
+// reproduce a published result, such as a mismatch seen in production, while
+// debugging. ControlFn and CandidateFn are both run and compared, whether or
+// not the experiment is enabled, and the new result is published and
+// returned.
+//
+// The input is r.Input as it is, unless the experiment's InputType is set and
+// the input is not of that type, as when the result was read back from JSON:
+// then the input, or the JSON in it if it is a json.RawMessage, such as one
+// returned by InputJSON, is decoded into a new value of InputType. If the
+// input cannot be decoded, or ControlFn or CandidateFn is nil, ReplayResult
+// returns nil.
+func ReplayResult(e *Experiment, r *Result) *Result {
+	if e.ControlFn == nil || e.CandidateFn == nil {
+		return nil
+	}
+
+	input, err := replayInput(e.InputType, r.Input)
+	if err != nil {
+		e.logf("science: experiment %q: cannot replay result %s: %v", e.Name, r.ID, err)
+		return nil
+	}
+
+	_, result, _ := e.runWith(call{input: input, wait: true, force: true})
+	return result
+}
+
+// replayInput returns input as a value of type t, decoding it from JSON if
+// need be. If t is nil, input is returned as it is.
+func replayInput(t reflect.Type, input interface{}) (interface{}, error) {
+	if t == nil || (input != nil && reflect.TypeOf(input).AssignableTo(t)) {
+		return input, nil
+	}
+
+	raw, ok := input.(json.RawMessage)
+	if !ok {
+		var err error
+		if raw, err = json.Marshal(input); err != nil {
+			return nil, err
+		}
+	}
+
+	v := reflect.New(t)
+	if err := json.Unmarshal(raw, v.Interface()); err != nil {
+		return nil, err
+	}
+	return v.Elem().Interface(), nil
+}
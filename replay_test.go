@@ -0,0 +1,100 @@
+package science
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExperimentReplay(t *testing.T) {
+	e := NewExperiment("test")
+	e.Enabled = func() bool { return false }
+	e.ControlFn = func(interface{}) interface{} {
+		t.Fatal("expected the control not to be run")
+		return nil
+	}
+	e.CandidateFn = func(in interface{}) interface{} { return strings.ToUpper(in.(string)) }
+
+	results := e.Replay([]Record{
+		{Input: "a", Output: "A"},
+		{Input: "b", Output: "b"},
+	})
+
+	if len(results) != 2 {
+		t.Fatalf("expected a result per record, got %d", len(results))
+	}
+	if !results[0].Matched || results[1].Matched {
+		t.Fatal("expected the candidate to be compared with the recorded outputs")
+	}
+	if results[1].Input != "b" || results[1].Control.Value != "b" || results[1].Candidate.Value != "B" {
+		t.Fatal("expected the results to record the input and both values")
+	}
+}
+
+func TestExperimentReplayWithoutCandidate(t *testing.T) {
+	e := NewExperiment("test")
+	results := e.Replay([]Record{{Input: 1, Output: 1}})
+	if len(results) != 1 || results[0] != nil {
+		t.Fatal("expected nil results without a CandidateFn")
+	}
+}
+
+func TestReplayResult(t *testing.T) {
+	type order struct {
+		ID    int
+		Items []string
+	}
+
+	e := NewExperiment("test")
+	e.InputType = reflect.TypeOf(order{})
+	e.ControlFn = func(in interface{}) interface{} { return len(in.(order).Items) }
+	e.CandidateFn = func(in interface{}) interface{} {
+		if o := in.(order); o.ID == 7 {
+			return 0
+		}
+		return len(in.(order).Items)
+	}
+
+	var published []*Result
+	e.Publish = func(r *Result) { published = append(published, r) }
+
+	e.RunWith(order{ID: 7, Items: []string{"a", "b"}})
+	mismatch := published[0]
+	if mismatch.Matched {
+		t.Fatal("expected the captured run to mismatch")
+	}
+
+	e.Enabled = func() bool { return false }
+	replayed := ReplayResult(e, mismatch)
+	if replayed == nil || replayed.Matched || replayed.Control.Value != 2 || replayed.Input.(order).ID != 7 {
+		t.Fatalf("expected the mismatch to be reproduced, got %v", replayed)
+	}
+	if len(published) != 2 {
+		t.Fatal("expected the replayed result to be published")
+	}
+
+	b, err := mismatch.InputJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayed := ReplayResult(e, &Result{Input: json.RawMessage(b)}); replayed == nil || replayed.Matched || replayed.Control.Value != 2 {
+		t.Fatalf("expected the mismatch to be reproduced from JSON, got %v", replayed)
+	}
+
+	var decoded Result
+	json.Unmarshal([]byte(`{"Input": {"ID": 7, "Items": ["a"]}}`), &decoded)
+	if replayed := ReplayResult(e, &decoded); replayed == nil || replayed.Matched || replayed.Control.Value != 1 {
+		t.Fatalf("expected a generically decoded input to be converted, got %v", replayed)
+	}
+
+	e.Logger = &testLogger{}
+	if ReplayResult(e, &Result{Input: json.RawMessage(`"not an order"`)}) != nil {
+		t.Fatal("expected an input that cannot be decoded not to be replayed")
+	}
+
+	e.CandidateFn = nil
+	if ReplayResult(e, mismatch) != nil {
+		t.Fatal("expected nil without a CandidateFn")
+	}
+}
@@ -0,0 +1,82 @@
+package science
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// String returns a one line summary of the result, such as
+//
+//	experiment=foo matched=true control=1.2ms candidate=800µs speedup=1.50x
+//
+// for logging and test failure messages. Results in which the candidate did
+// not run give the reason instead of the candidate's details.
+func (r *Result) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "experiment=%s", r.Name)
+
+	if r.Candidate == nil {
+		if r.SkipReason != "" {
+			fmt.Fprintf(&b, " skipped=%q", r.SkipReason)
+		} else {
+			b.WriteString(" candidate=none")
+		}
+		if r.Control != nil {
+			fmt.Fprintf(&b, " control=%s", shortDuration(r.Control.Duration))
+		}
+		return b.String()
+	}
+
+	if r.Compared {
+		fmt.Fprintf(&b, " matched=%t", r.Matched)
+	} else {
+		b.WriteString(" compared=false")
+	}
+
+	if r.Control != nil {
+		fmt.Fprintf(&b, " control=%s", shortDuration(r.Control.Duration))
+	}
+	fmt.Fprintf(&b, " candidate=%s", shortDuration(r.Candidate.Duration))
+	if speedup := r.Speedup(); r.Control != nil && !math.IsInf(speedup, 1) {
+		fmt.Fprintf(&b, " speedup=%.2fx", speedup)
+	}
+
+	if r.Candidate.Panicked {
+		b.WriteString(" panicked=true")
+	}
+	if r.ComparisonErr != nil {
+		fmt.Fprintf(&b, " error=%q", r.ComparisonErr.Error())
+	}
+	return b.String()
+}
+
+// Speedup returns how many times faster the candidate ran than the control:
+// the control's Duration divided by the candidate's, so 2 means the
+// candidate took half as long. Durations are measured with the monotonic
+// clock to the nanosecond, but branches that do almost nothing can still
+// measure as zero. If both durations are zero the branches are taken to be
+// equally fast and Speedup returns 1; if only the candidate's is zero it
+// returns +Inf. A result without both observations has a Speedup of 0.
+func (r *Result) Speedup() float64 {
+	if r.Control == nil || r.Candidate == nil {
+		return 0
+	}
+	control, candidate := r.Control.Duration, r.Candidate.Duration
+	switch {
+	case candidate == 0 && control == 0:
+		return 1
+	case candidate == 0:
+		return math.Inf(1)
+	}
+	return float64(control) / float64(candidate)
+}
+
+// shortDuration rounds d to the microsecond, so that it prints compactly.
+func shortDuration(d time.Duration) time.Duration {
+	if d < time.Microsecond {
+		return d
+	}
+	return d.Round(time.Microsecond)
+}
@@ -0,0 +1,86 @@
+package science
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestResultString(t *testing.T) {
+	r := &Result{
+		Name:      "foo",
+		Matched:   true,
+		Compared:  true,
+		Control:   &Observation{Duration: 1200 * time.Microsecond},
+		Candidate: &Observation{Duration: 800 * time.Microsecond},
+	}
+
+	want := "experiment=foo matched=true control=1.2ms candidate=800µs speedup=1.50x"
+	if got := r.String(); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+
+	r.Compared = false
+	r.Candidate.Panicked = true
+	want = "experiment=foo compared=false control=1.2ms candidate=800µs speedup=1.50x panicked=true"
+	if got := r.String(); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+
+	r.Candidate.Panicked = false
+	r.ComparisonErr = errors.New("bad json")
+	want = "experiment=foo compared=false control=1.2ms candidate=800µs speedup=1.50x error=\"bad json\""
+	if got := r.String(); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func TestResultSpeedup(t *testing.T) {
+	observations := func(control, candidate time.Duration) *Result {
+		return &Result{
+			Control:   &Observation{Duration: control},
+			Candidate: &Observation{Duration: candidate},
+		}
+	}
+
+	if s := observations(3*time.Millisecond, time.Millisecond).Speedup(); s != 3 {
+		t.Fatalf("expected a speedup of 3, got %v", s)
+	}
+	if s := observations(0, 0).Speedup(); s != 1 {
+		t.Fatalf("expected a speedup of 1 when both durations are zero, got %v", s)
+	}
+	if s := observations(time.Millisecond, 0).Speedup(); !math.IsInf(s, 1) {
+		t.Fatalf("expected an infinite speedup when the candidate took no time, got %v", s)
+	}
+	if s := observations(0, time.Millisecond).Speedup(); s != 0 {
+		t.Fatalf("expected a speedup of 0 when the control took no time, got %v", s)
+	}
+	if s := (&Result{Control: &Observation{}}).Speedup(); s != 0 {
+		t.Fatalf("expected a speedup of 0 without a candidate, got %v", s)
+	}
+
+	r := observations(time.Millisecond, 0)
+	r.Compared = true
+	if got := r.String(); got != "experiment= matched=false control=1ms candidate=0s" {
+		t.Fatalf("expected an infinite speedup not to be printed, got %q", got)
+	}
+}
+
+func TestResultStringWithoutCandidate(t *testing.T) {
+	r := &Result{
+		Name:       "foo",
+		Control:    &Observation{Duration: 1234567 * time.Nanosecond},
+		SkipReason: SkipDisabled,
+	}
+
+	want := `experiment=foo skipped="disabled" control=1.235ms`
+	if got := r.String(); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+
+	r = &Result{Name: "foo"}
+	if got := r.String(); got != "experiment=foo candidate=none" {
+		t.Fatalf("expected a result with no observations to print, got %q", got)
+	}
+}
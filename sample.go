@@ -0,0 +1,21 @@
+package science
+
+import "hash/fnv"
+
+// sampled reports whether the run should go ahead under SampleKey and
+// SamplePercent. The key is hashed together with the experiment's name, so
+// the same key always gets the same decision for one experiment, while
+// different experiments sample different sets of keys.
+func (e *Experiment) sampled() bool {
+	if e.SampleKey == nil {
+		return true
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(e.Name))
+	h.Write([]byte{0})
+	h.Write([]byte(e.SampleKey()))
+
+	// Buckets of a hundredth of a percent allow percentages such as 0.5.
+	return float64(h.Sum64()%10000) < e.SamplePercent*100
+}
@@ -0,0 +1,62 @@
+package science
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestExperimentSampleKey(t *testing.T) {
+	var key string
+	e := NewExperiment("test")
+	e.SampleKey = func() string { return key }
+	e.SamplePercent = 10
+	e.Control = func() interface{} { return 1 }
+	e.Candidate = func() interface{} { return 1 }
+
+	ran := func(k string) bool {
+		key = k
+		before := e.Stats().Matches
+		e.Run()
+		return e.Stats().Matches > before
+	}
+
+	decisions := map[string]bool{}
+	sampled := 0
+	for i := 0; i < 1000; i++ {
+		k := "user-" + strconv.Itoa(i)
+		decisions[k] = ran(k)
+		if decisions[k] {
+			sampled++
+		}
+	}
+
+	if sampled < 50 || sampled > 150 {
+		t.Fatalf("expected about 10%% of keys to be sampled, got %d of 1000", sampled)
+	}
+
+	for k, want := range decisions {
+		if ran(k) != want {
+			t.Fatalf("expected the decision for %q to be stable", k)
+		}
+	}
+}
+
+func TestExperimentSampleKeyBounds(t *testing.T) {
+	e := NewExperiment("test")
+	e.SampleKey = func() string { return "user" }
+
+	if e.sampled() {
+		t.Fatal("expected no keys to be sampled at 0%")
+	}
+
+	e.SamplePercent = 100
+	if !e.sampled() {
+		t.Fatal("expected every key to be sampled at 100%")
+	}
+
+	e.SampleKey = nil
+	e.SamplePercent = 0
+	if !e.sampled() {
+		t.Fatal("expected sampling to be off without a SampleKey")
+	}
+}
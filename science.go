@@ -34,9 +34,14 @@
 package science
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"math/rand"
 	"reflect"
+	"runtime"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -45,18 +50,45 @@ var (
 	ErrNoControl    = errors.New("control function missing")
 	ErrNoCandidate  = errors.New("candidate function missing")
 	ErrNoComparator = errors.New("comparator function missing")
+	ErrMismatch     = errors.New("candidate did not match control")
 )
 
+// MismatchError is the error returned by Run when ErrorOnMismatch is set and
+// the candidate did not match the control. It matches ErrMismatch with
+// errors.Is, and carries the run's result.
+type MismatchError struct {
+	Result *Result
+}
+
+func (err *MismatchError) Error() string {
+	return fmt.Sprintf("experiment %q: %v", err.Result.Name, ErrMismatch)
+}
+
+// Is reports whether target is ErrMismatch.
+func (err *MismatchError) Is(target error) bool {
+	return target == ErrMismatch
+}
+
 // The ExperimentFunc type is a function containing the code for the control
 // and candidate of the experiment. This function can return any value. The
 // values returned from the control and candidate functions are compared using
 // a ComparatorFunc.
 type ExperimentFunc func() interface{}
 
+// The InputFunc type is a variant of ExperimentFunc that takes an input, for
+// experiments run with RunWith or RunTable. The control and candidate are
+// given the same input.
+type InputFunc func(input interface{}) interface{}
+
 // The ComparatorFunc type is a function which compares the return values of
-// the Control and Candidate functions. By default, reflect.DeepEqual is used.
+// the Control and Candidate functions. By default, DeepEqual is used.
 type ComparatorFunc func(interface{}, interface{}) bool
 
+// The ScoreFunc type is a function that rates how similar the control and
+// candidate values are, from 0 for nothing alike to 1 for the same, for
+// values such as rankings where an exact match is too strict.
+type ScoreFunc func(control, candidate interface{}) float64
+
 // The EnabledFunc type is a function which  determines if the expermint is to
 // be run. By default, this is a function that always returns true. If the
 // function is nil or returns false, the Control will be run without any
@@ -64,110 +96,1444 @@ type ComparatorFunc func(interface{}, interface{}) bool
 // be run.
 type EnabledFunc func() bool
 
+// The ContextEnabledFunc type is a variant of EnabledFunc that is given the
+// context passed to RunContext, so that the decision can depend on request
+// scoped values.
+type ContextEnabledFunc func(context.Context) bool
+
+// The ContextComparatorFunc type is a variant of ComparatorFunc that is given
+// the context passed to RunContext, so that the comparison can depend on
+// request scoped values, such as a tolerance that differs by tenant.
+type ContextComparatorFunc func(ctx context.Context, control, candidate interface{}) bool
+
 // PublishFunc is a function that receives the results Result of the experiment.
 type PublishFunc func(*Result)
 
+// Logger is used to report problems encountered while running an experiment
+// that should not interrupt the caller, such as a Publish function exceeding
+// its timeout. It is satisfied by *log.Logger.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
 // Experiment is the experiment to run.
+//
+// An Experiment may be run from any number of goroutines at once, as long as
+// its fields are not changed while it runs; SetPublish and SetEnabled can be
+// used instead. Every run keeps its own state, so a single experiment can be
+// shared by concurrent request handlers that pass request scoped data to
+// RunWith as its input, rather than each building an experiment whose
+// Control and Candidate close over the data.
 type Experiment struct {
-	Name         string
-	Control      ExperimentFunc
-	Candidate    ExperimentFunc
-	Comparator   ComparatorFunc
-	Enabled      EnabledFunc
-	Publish      PublishFunc
+	Name      string
+	Control   ExperimentFunc
+	Candidate ExperimentFunc
+	// Comparator decides whether the values match. A panic in it propagates
+	// to the caller, like one in the control; comparators that can fail,
+	// like JSONCanonicalComparator, have their failures recorded in
+	// Result.ComparisonErr instead.
+	Comparator ComparatorFunc
+	Enabled    EnabledFunc
+	Publish    PublishFunc
+	Logger     Logger
+
+	// ComparatorName, if set, names a comparator registered with
+	// RegisterComparator, which is used in place of Comparator. If no
+	// comparator is registered under the name, Run returns ErrNoComparator.
+	ComparatorName string
+
+	// ContextEnabled, if set, is used in place of Enabled by RunContext.
+	ContextEnabled ContextEnabledFunc
+
+	// ContextComparator, if set, is used in place of Comparator and
+	// ComparatorName by RunContext, and is given the context RunContext
+	// was called with. Other ways of running the experiment use Comparator.
+	ContextComparator ContextComparatorFunc
+
+	// SampleKey, if set, limits the candidate to a stable sample of keys,
+	// such as user IDs: it is called on each enabled run, and the candidate
+	// runs only if the key hashes into the first SamplePercent percent of
+	// keys. The same key always gets the same decision, so an entity is
+	// either always or never in the experiment.
+	SampleKey     func() string
+	SamplePercent float64
+
+	// ControlFn and CandidateFn are used in place of Control and Candidate
+	// by RunWith and RunTable.
+	ControlFn   InputFunc
+	CandidateFn InputFunc
+
+	// Setup, if set, is called by Run, RunValue, and RunContext to prepare
+	// an input shared by both branches, such as a parsed request body. Its
+	// result is passed to ControlFn and CandidateFn in place of running
+	// Control and Candidate. Setup runs exactly once per run, before the
+	// ordering of the branches is decided and whether or not the candidate
+	// is enabled.
+	Setup func() interface{}
+
+	// BeforeObserve and AfterObserve, if set, are called before and after
+	// each branch runs with the name of the branch, "control" or
+	// "candidate", and its observation, so that they can record details in
+	// the observation's Extra map, such as the number of queries the branch
+	// made. Extra is empty, not nil, when the first of them is called.
+	// AfterObserve is called even if the branch panics. Neither is called
+	// for runs in which the candidate is skipped, for example because the
+	// experiment is disabled, so that they only measure the branches being
+	// compared. Panics in either are recovered and logged. CountQueries sets
+	// both.
+	BeforeObserve func(branch string, o *Observation)
+	AfterObserve  func(branch string, o *Observation)
+
+	// ExtraControls are further implementations the candidate must match,
+	// keyed by name, for consolidating several old code paths into one. Each
+	// runs after the control and candidate, in name order, and is compared
+	// with the candidate, the outcome being recorded in Result.ExtraMatched;
+	// the run only matches if the candidate matches every one of them, as
+	// well as the control. The control's value is still what the caller
+	// receives. Panics in extra controls are recovered, and an extra control
+	// that panics is left out of the comparison.
+	ExtraControls map[string]ExperimentFunc
+
+	// BaselineOnly makes the experiment measure only its control, for
+	// collecting a baseline before the candidate has been written, and the
+	// candidate may be nil. A run that would have run the candidate instead
+	// publishes a result with the control's observation, a nil Candidate,
+	// and the reason SkipBaseline, whether or not AlwaysPublish is set. The
+	// other reasons to skip the candidate, such as the experiment being
+	// disabled, paused, or not sampled, take precedence, and those runs are
+	// only published if AlwaysPublish is set. Turning it off starts the
+	// experiment proper. RunAgainstGolden and Replay, which need a
+	// candidate, ignore it.
+	BaselineOnly bool
+
+	// RecoverControl, if set, recovers panics in the control as well as the
+	// candidate, recording them in the control's Observation. The caller
+	// receives a nil value, and the run is published but not compared. This
+	// is meant for offline verification, such as RunTable over recorded
+	// inputs, where one bad input should not abort the whole batch. By
+	// default, control panics propagate to the caller.
+	RecoverControl bool
+
+	// InputCloner, if set, is used by RunWith to copy the input before either
+	// branch runs. The candidate is given the copy and the control the
+	// original, so the candidate cannot modify data the control depends on.
+	// It is only called on runs in which the candidate is to run, so no copy
+	// is made when the experiment is disabled or the run is not sampled.
+	InputCloner func(input interface{}) interface{}
+
+	// CleanInput, if set, is applied to the input given to RunWith before it
+	// is stored in Result.Input, for example to remove sensitive data.
+	CleanInput func(input interface{}) interface{}
+
+	// Clean, if set, is applied to each branch's value before it is
+	// published, for example to strip timestamps or sensitive fields. The
+	// caller still receives the raw value. Cleaning happens before the
+	// published values are hashed, discarded, or redacted. Clean is not
+	// called on the value of a branch that panicked, or on a value that is
+	// not of the ExpectedType. A panic in Clean on the control's value
+	// propagates to the caller; on any other branch's value it is recovered
+	// and logged, and the value is left out of the published result.
+	Clean func(value interface{}) interface{}
+
+	// CompareCleaned applies Clean to both values before they are compared
+	// as well, so that SkipCompareIf and the Comparator see the cleaned
+	// values. ExpectedType is still checked against the raw values. When
+	// CompareCleaned is false, the raw values are compared and Clean only
+	// affects what is published.
+	CompareCleaned bool
+
+	// Golden is the known good value compared with the candidate's by
+	// RunAgainstGolden.
+	Golden interface{}
+
+	// Redact replaces the values in the published observations with a
+	// placeholder describing only their type and length. The real values
+	// are still compared and returned to the caller. Only the values are
+	// redacted: Result.Input is published as given, unless CleanInput is
+	// set, and so are the lines captured in Observation.Logs.
+	Redact bool
+
+	// HashValues stores a hash of each branch's value in Observation.Hash,
+	// so that divergence can be tracked without keeping the values.
+	HashValues bool
+
+	// DiscardValues removes the values from the published observations once
+	// they have been compared and hashed.
+	DiscardValues bool
+
+	// ReturnCandidate makes RunValue return the candidate's value instead of
+	// the control's, but only when the two matched.
+	ReturnCandidate bool
+
+	// ReturnFaster makes RunValue return the value of whichever branch took
+	// less time, but only when the two matched; on a mismatch the control's
+	// value is returned as usual. This only makes sense once the candidate
+	// is trusted, for example a fully validated refactor, as the caller
+	// receives its value whenever it wins. ReturnCandidate takes precedence
+	// if both are set, and ReturnFaster has no effect in Shadow mode.
+	ReturnFaster bool
+
+	// SkipPublishOnMatchedError suppresses publishing a result when the
+	// values matched and both branches returned equal non-nil errors, as
+	// ErrorComparator compares them, which during an outage is almost
+	// always an upstream problem rather than a signal about the candidate.
+	// A branch's error is its value if that is an error, or the last of its
+	// Values. The run is still counted in Stats, and results that mismatched
+	// or were not compared are published as usual, even if their errors
+	// are equal.
+	SkipPublishOnMatchedError bool
+
+	// ErrorOnMismatch makes Run and the other run methods return a
+	// *MismatchError, matching ErrMismatch, when the candidate does not
+	// match the control, so that the same experiment can assert parity in a
+	// test. The value the caller should use is still returned alongside it.
+	// It has no effect in Shadow mode, where the comparison happens after Run
+	// returns.
+	ErrorOnMismatch bool
+
+	// ResultFilter, if set, is called with each result just before it is
+	// published, after Clean, DiscardValues, and Redact have been applied.
+	// It may modify the result or return a different one, which is what is
+	// then published and sent on the Events channel, or return nil to drop
+	// the result entirely. Results returned by RunTable, RunAgainstGolden,
+	// and Replay are not filtered. Panics in ResultFilter are recovered and
+	// logged, and the result is dropped.
+	ResultFilter func(*Result) *Result
+
+	// AlwaysPublish makes Run publish a result even when the candidate is
+	// not run. The result has the control's observation, a nil Candidate,
+	// and a SkipReason.
+	AlwaysPublish bool
+
+	// Async makes Run call Publish on a new goroutine rather than waiting
+	// for it. Panics in Publish are then recovered and logged. Call Shutdown
+	// before the process exits to wait for outstanding publishes.
+	Async bool
+
+	// Shadow runs the candidate off the request path: Run runs the control
+	// and returns its value at once, and the candidate is run, compared,
+	// and published on a new goroutine afterwards, so the caller never waits
+	// for it. The caller must not modify the control's value while the
+	// candidate may still be running, as it is compared later. RunTable and
+	// RunAgainstGolden, which return the result, ignore Shadow, and
+	// StreamPublish and ReturnCandidate have no effect. The candidate is
+	// still skipped if the control took longer than Deadline or
+	// SkipCandidateIfControlSlowerThan allow. Call Shutdown before the
+	// process exits to wait for outstanding candidates.
+	Shadow bool
+
+	// PublishTimeout bounds how long Run waits for Publish to return. If it
+	// is exceeded, Run logs the timeout and returns, leaving Publish to finish
+	// in the background. A zero value waits indefinitely.
+	PublishTimeout time.Duration
+
+	// ExpectedType, if set, is the type both branches should return. If
+	// either value is not assignable to it, the run is a mismatch with
+	// Result.TypeMismatch set, and the comparator is not called.
+	ExpectedType reflect.Type
+
+	// InputType, if set, is the type of the input RunWith is given. It is
+	// used by ReplayResult to decode an input that was serialized, for
+	// example with Result.InputJSON, back into the type the branches expect.
+	InputType reflect.Type
+
+	// ComparatorTimeout, if positive, bounds how long a run waits for the
+	// Comparator, protecting the caller from a comparator that is slow on
+	// large values. The comparator is run on a new goroutine, and if it has
+	// not returned in time the result is marked ComparisonTimedOut and the
+	// values are treated as not compared, rather than as a mismatch.
+	ComparatorTimeout time.Duration
+
+	// Score, if set, rates how similar the values are whenever they are
+	// compared, and the rating is stored in Result.Score, so that how close
+	// the candidate is can be tracked over time and not only whether it
+	// matched. The values match if the score is at least ScoreThreshold.
+	// Score is used in place of Comparator, ComparatorName, and
+	// ContextComparator, and like them is bounded by ComparatorTimeout and
+	// RunContext's context. Values that are the same pointer match with a
+	// score of 1 without Score being called.
+	Score ScoreFunc
+
+	// ScoreThreshold is the lowest score from Score at which the values
+	// match.
+	ScoreThreshold float64
+
+	// SkipCompareIf, if set, is called with the control and candidate values
+	// before they are compared. If it returns true the run is left out of
+	// comparison altogether: the result has Compared set to false, and the
+	// run counts as neither a match nor a mismatch.
+	SkipCompareIf func(control, candidate interface{}) bool
+
+	// OnMismatch is called with the result of every run in which the control
+	// and candidate did not match, in addition to Publish. Panics in
+	// OnMismatch are recovered and logged.
+	OnMismatch func(*Result)
+
+	// MeasureCPU records the CPU time used by each branch in
+	// Observation.CPUTime, which is steadier than wall time on a busy
+	// machine. It is only supported on Linux, where each branch is locked to
+	// its OS thread while it runs and the thread's CPU time is measured, so
+	// work a branch hands off to other goroutines is not counted. On other
+	// platforms CPUTime is always zero.
+	MeasureCPU bool
+
+	// LogCapture, if set, is called before each branch runs to start
+	// capturing log output. The function it returns is called once the
+	// branch finishes, and its lines are stored in Observation.Logs.
+	LogCapture func() (capture func() []string)
+
+	// StreamPublish, if set, is called every StreamInterval while the
+	// branches are running with a partial result showing their progress so
+	// far, for experiments on long-running calls. Panics in StreamPublish are
+	// recovered and logged.
+	StreamPublish  func(partial *Result)
+	StreamInterval time.Duration
+
+	// Warmup is the number of initial enabled runs whose results are marked
+	// with Result.Warmup, so publishers can leave them out of timing stats.
+	Warmup int
+
+	// PercentileWindow is the number of recent durations per branch used
+	// by Percentiles. It defaults to DefaultPercentileWindow.
+	PercentileWindow int
+
+	// BreakerThreshold is the number of consecutive candidate failures,
+	// panics or mismatches, after which the breaker trips and the candidate
+	// is no longer run. Zero disables the breaker.
+	BreakerThreshold int
+
+	// Deadline, if positive, bounds the time a run spends on both branches
+	// together, limiting the latency an experiment adds to a request. Runs
+	// that take longer are logged and marked with Result.DeadlineExceeded.
+	// The control always runs to completion, as its value is returned to the
+	// caller, but if it runs first and uses up the whole deadline the
+	// candidate is skipped, as if the experiment were not enabled, with the
+	// reason SkipDeadline. A candidate that runs first is never skipped.
+	Deadline time.Duration
+
+	// CallerFile and CallerLine are where the experiment was created, if
+	// CaptureCaller was set when NewExperiment was called.
+	CallerFile string
+	CallerLine int
+
+	// SkipCandidateIfControlSlowerThan, if positive, is a safety valve for
+	// degraded systems: the control always runs first, and the candidate is
+	// skipped, with the reason SkipControlSlow, if the control took longer
+	// than this. A slow control is taken as a sign that the system is
+	// struggling, when running the candidate would only add to the load.
+	SkipCandidateIfControlSlowerThan time.Duration
+
+	// DurationBudget, if positive, is the longest the candidate should take,
+	// as an absolute limit rather than relative to the control. Each result
+	// records whether the candidate kept to it in CandidateWithinBudget.
+	DurationBudget time.Duration
+
+	// EventsBuffer is the capacity of the channel returned by Events. It
+	// defaults to DefaultEventsBuffer.
+	EventsBuffer int
+
 	controlFirst bool
+	paused       atomic.Bool
+	counters     counters
+	failures     atomic.Int64 // consecutive candidate failures, for the breaker
+	durations    durationWindows
+	runs         atomic.Int64 // enabled runs, for Warmup
+	events       events
+	livePublish  atomic.Pointer[PublishFunc] // set by SetPublish
+	liveEnabled  atomic.Pointer[EnabledFunc] // set by SetEnabled
 }
 
 // Result is the result sent to the Publish function, if one is provided.
 type Result struct {
-	Name         string       // Name of the experiment
-	Timestamp    time.Time    // Time the experiment started
-	ControlFirst bool         // Whether the Control ran before the Candidate
-	Matched      bool         // Whether the control and candidate values matched
-	Control      *Observation // Control results
-	Candidate    *Observation // Candidate results
+	ID                    string                  // Unique ID of the run, shared by its partial results
+	Name                  string                  // Name of the experiment
+	Timestamp             time.Time               // Time the experiment started
+	ControlFirst          bool                    // Whether the Control ran before the Candidate
+	Matched               bool                    // Whether the control and candidate values matched
+	Compared              bool                    // Whether the values were compared; if not, Matched is meaningless
+	TypeMismatch          bool                    // Whether a value was not of the experiment's ExpectedType
+	ComparisonErr         error                   // Why the comparator failed, leaving the values not compared
+	ComparisonTimedOut    bool                    // Whether the comparator outlasted ComparatorTimeout, leaving the values not compared
+	ComparisonCancelled   bool                    // Whether the context given to RunContext was done before the comparator finished, leaving the values not compared
+	Score                 float64                 // Similarity of the values according to the experiment's Score, if set and the values were compared
+	Control               *Observation            // Control results
+	Candidate             *Observation            // Candidate results
+	ExtraControls         map[string]*Observation // Results of the experiment's ExtraControls, by name
+	ExtraMatched          map[string]bool         // Whether the candidate matched each extra control it was compared with
+	Returned              string                  // Which value the caller received, "control" or "candidate"
+	Warmup                bool                    // Whether the run was one of the experiment's Warmup runs
+	Input                 interface{}             // Input given to RunWith, after CleanInput
+	Partial               bool                    // Whether this is an in-progress result sent to StreamPublish
+	SkipReason            string                  // Why the candidate did not run, for AlwaysPublish results
+	DeadlineExceeded      bool                    // Whether the branches together took longer than the experiment's Deadline
+	CandidateWithinBudget bool                    // Whether the candidate took no longer than the experiment's DurationBudget, if set
+	CallerFile            string                  // Where the experiment was created, if CaptureCaller was set
+	CallerLine            int                     // Line of CallerFile where the experiment was created
+	Config                Config                  // How the experiment was configured when it ran
 }
 
+// Reasons given in Result.SkipReason when only the control ran.
+const (
+	SkipDisabled    = "disabled"     // Experiments were turned off with SetDisabled
+	SkipPaused      = "paused"       // The experiment was paused
+	SkipBreaker     = "breaker"      // The experiment's breaker had tripped
+	SkipNotEnabled  = "not enabled"  // The experiment's Enabled function returned false
+	SkipDeadline    = "deadline"     // The control ran first and used up the experiment's Deadline
+	SkipNotSampled  = "not sampled"  // The run's SampleKey fell outside SamplePercent
+	SkipControlSlow = "control slow" // The control took longer than SkipCandidateIfControlSlowerThan
+	SkipBaseline    = "baseline"     // The experiment is BaselineOnly
+)
+
 // Observation stores the results of running the Control or Candidate functions.
 type Observation struct {
+	Which    string        // Branch observed: "control", "candidate", or the name of an extra control
 	Duration time.Duration // Duration of the function call
+	Start    time.Time     // Time the function was called
+	End      time.Time     // Time the function returned or panicked
 	Value    interface{}   // Return value of the function
+	Logs     []string      // Log lines captured during the call, if LogCapture is set
+	Panicked bool          // Whether the function panicked
+	Panic    interface{}   // Value the function panicked with
+	Hash     uint64        // Hash of the value, if HashValues is set
+	CPUTime  time.Duration // CPU time used by the function call, if MeasureCPU is set
+
+	// Extra holds branch specific details added by AfterObserve, such as the
+	// number of rows scanned or whether a cache was hit.
+	Extra map[string]interface{}
 }
 
-// NewExperiment creates a new Experiment with the given name. The default
-// Comparator function iw reflect.DeepEqual. The experiment is Enabled by
-// default.
-func NewExperiment(name string) *Experiment {
-	controlFirst := rand.Intn(2) == 0
-	return &Experiment{
+// Defaults used by NewExperiment. They should be set before any experiments
+// are created, typically at program start up. An experiment whose Comparator
+// is nil also falls back to DefaultComparator when it runs.
+var (
+	DefaultComparator ComparatorFunc = DeepEqual
+	DefaultPublish    PublishFunc
+
+	// CaptureCaller makes NewExperiment record the file and line it was
+	// called from in the experiment's CallerFile and CallerLine, which are
+	// copied to each Result, so a mismatch can be traced back to where the
+	// experiment is defined. It is off by default, as finding the caller
+	// has a small cost.
+	CaptureCaller bool
+
+	// OnRun, if set, is called with every result any experiment publishes,
+	// matched or not, including the control only results of AlwaysPublish
+	// and BaselineOnly, as a single place to observe every experiment in
+	// the process for auditing or metrics. It is called in addition to the
+	// experiment's Publish, whether or not that is set, after ResultFilter
+	// and before Publish, on the goroutine that finished the run, so it
+	// should be quick. A panic in OnRun is logged and recovered.
+	OnRun func(*Result)
+)
+
+// NewExperiment creates a new Experiment with the given name. The Comparator
+// and Publish functions default to DefaultComparator and DefaultPublish. The
+// experiment is Enabled by default. Any options are applied to the experiment
+// in order.
+func NewExperiment(name string, opts ...Option) *Experiment {
+	e := &Experiment{
 		Name:         name,
-		Comparator:   reflect.DeepEqual,
+		Comparator:   DefaultComparator,
+		Publish:      DefaultPublish,
 		Enabled:      enabledByDefault,
-		controlFirst: controlFirst}
+		controlFirst: chooseOrder()}
+	e.captureCaller(1)
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// captureCaller records the caller skip frames above the function calling
+// it, if CaptureCaller is set.
+func (e *Experiment) captureCaller(skip int) {
+	if !CaptureCaller {
+		return
+	}
+	if _, file, line, ok := runtime.Caller(skip + 1); ok {
+		e.CallerFile, e.CallerLine = file, line
+	}
+}
+
+// Clone returns a copy of the experiment's configuration, for use as a
+// per-call instance of a template experiment. Per-run state, such as the
+// number of runs counted towards Warmup, is not copied, and the clone chooses
+// its own ordering.
+func (e *Experiment) Clone() *Experiment {
+	return &Experiment{
+		Name:                             e.Name,
+		Control:                          e.Control,
+		Candidate:                        e.Candidate,
+		ControlFn:                        e.ControlFn,
+		CandidateFn:                      e.CandidateFn,
+		Setup:                            e.Setup,
+		RecoverControl:                   e.RecoverControl,
+		BaselineOnly:                     e.BaselineOnly,
+		ExtraControls:                    copyControls(e.ExtraControls),
+		BeforeObserve:                    e.BeforeObserve,
+		AfterObserve:                     e.AfterObserve,
+		InputCloner:                      e.InputCloner,
+		CleanInput:                       e.CleanInput,
+		Clean:                            e.Clean,
+		CompareCleaned:                   e.CompareCleaned,
+		Golden:                           e.Golden,
+		Redact:                           e.Redact,
+		HashValues:                       e.HashValues,
+		DiscardValues:                    e.DiscardValues,
+		Comparator:                       e.Comparator,
+		ComparatorName:                   e.ComparatorName,
+		Enabled:                          e.enabledFunc(),
+		ContextEnabled:                   e.ContextEnabled,
+		ContextComparator:                e.ContextComparator,
+		SampleKey:                        e.SampleKey,
+		SamplePercent:                    e.SamplePercent,
+		Publish:                          e.publishFunc(),
+		Logger:                           e.Logger,
+		ReturnCandidate:                  e.ReturnCandidate,
+		ReturnFaster:                     e.ReturnFaster,
+		AlwaysPublish:                    e.AlwaysPublish,
+		ResultFilter:                     e.ResultFilter,
+		ErrorOnMismatch:                  e.ErrorOnMismatch,
+		SkipPublishOnMatchedError:        e.SkipPublishOnMatchedError,
+		Async:                            e.Async,
+		Shadow:                           e.Shadow,
+		PublishTimeout:                   e.PublishTimeout,
+		ExpectedType:                     e.ExpectedType,
+		InputType:                        e.InputType,
+		SkipCompareIf:                    e.SkipCompareIf,
+		Score:                            e.Score,
+		ScoreThreshold:                   e.ScoreThreshold,
+		ComparatorTimeout:                e.ComparatorTimeout,
+		OnMismatch:                       e.OnMismatch,
+		Warmup:                           e.Warmup,
+		MeasureCPU:                       e.MeasureCPU,
+		LogCapture:                       e.LogCapture,
+		StreamPublish:                    e.StreamPublish,
+		StreamInterval:                   e.StreamInterval,
+		PercentileWindow:                 e.PercentileWindow,
+		BreakerThreshold:                 e.BreakerThreshold,
+		EventsBuffer:                     e.EventsBuffer,
+		Deadline:                         e.Deadline,
+		DurationBudget:                   e.DurationBudget,
+		SkipCandidateIfControlSlowerThan: e.SkipCandidateIfControlSlowerThan,
+		CallerFile:                       e.CallerFile,
+		CallerLine:                       e.CallerLine,
+		controlFirst:                     chooseOrder(),
+	}
+}
+
+var disabled atomic.Bool
+
+// SetDisabled turns every experiment in the process off or back on. While
+// disabled, all experiments run only their Control, whatever their Enabled
+// function says. It is safe to call at any time from any goroutine.
+func SetDisabled(d bool) {
+	disabled.Store(d)
+}
+
+// Disabled reports whether experiments have been turned off with SetDisabled.
+func Disabled() bool {
+	return disabled.Load()
 }
 
-// Run runs the experiment. If any of the Control, Candidate, or Comparator are
-// nil, Run will return an appropriate error.
+var order struct {
+	sync.Mutex
+	fixed        bool
+	controlFirst bool
+}
+
+// SetDeterministicOrder makes every experiment created afterwards run its
+// Control first if controlFirst is true, or its Candidate first otherwise.
+// Experiments otherwise run their Control first. It is intended for tests
+// that need to exercise a particular ordering, and is safe to call from
+// multiple goroutines. Use ClearDeterministicOrder to restore the default.
+func SetDeterministicOrder(controlFirst bool) {
+	order.Lock()
+	defer order.Unlock()
+	order.fixed = true
+	order.controlFirst = controlFirst
+}
+
+// ClearDeterministicOrder undoes SetDeterministicOrder, so that new
+// experiments run their Control first again.
+func ClearDeterministicOrder() {
+	order.Lock()
+	defer order.Unlock()
+	order.fixed = false
+}
+
+func chooseOrder() bool {
+	order.Lock()
+	defer order.Unlock()
+	if order.fixed {
+		return order.controlFirst
+	}
+	return true
+}
+
+// Run runs the experiment. It returns ErrNoControl if Control is nil, and
+// ErrNoCandidate if Candidate is nil, unless BaselineOnly is set. It returns
+// ErrNoComparator if ComparatorName names no registered comparator, or if
+// Comparator is nil and so is DefaultComparator, which a nil Comparator
+// otherwise falls back to; a BaselineOnly experiment needs no comparator.
 func (e *Experiment) Run() error {
-	if e.Control == nil {
-		return ErrNoControl
+	_, err := e.RunValue()
+	return err
+}
+
+// RunValue runs the experiment like Run and returns the value the caller
+// should use. This is the control's value unless ReturnCandidate or
+// ReturnFaster is set and the candidate matched it.
+func (e *Experiment) RunValue() (interface{}, error) {
+	value, _, err := e.start(call{})
+	return value, err
+}
+
+// RunContext runs the experiment like Run. If ContextEnabled is set, it is
+// called with ctx in place of Enabled. If ctx is done before the values have
+// been compared, the comparison is abandoned and the result records
+// ComparisonCancelled, so that a slow comparator cannot hold up Run once its
+// request is over; a ContextComparator is given ctx to observe itself.
+func (e *Experiment) RunContext(ctx context.Context) error {
+	_, _, err := e.start(call{ctx: ctx})
+	return err
+}
+
+// RunWith runs the experiment using ControlFn and CandidateFn, passing input
+// to each, and returns the value the caller should use as RunValue does.
+func (e *Experiment) RunWith(input interface{}) (interface{}, error) {
+	value, _, err := e.runWith(call{input: input})
+	return value, err
+}
+
+// RunTable runs the experiment with RunWith once for each of the inputs and
+// returns the results in the same order, whether or not Publish is set. An
+// entry is nil if ControlFn or CandidateFn is missing, or if the candidate
+// was not run for that input, for example because the experiment is
+// disabled, unless AlwaysPublish is set.
+func (e *Experiment) RunTable(inputs []interface{}) []*Result {
+	results := make([]*Result, len(inputs))
+	for i, input := range inputs {
+		_, results[i], _ = e.runWith(call{input: input, wait: true})
+	}
+	return results
+}
+
+// RunAgainstGolden runs the Candidate and compares its value with Golden in
+// place of running the Control, whose observation has the Golden value and a
+// zero duration. The candidate is run whether or not the experiment is
+// enabled, and the result is returned as well as being published. This lets a
+// test check that a candidate still produces a known good output without
+// needing the control's code.
+func (e *Experiment) RunAgainstGolden() (*Result, error) {
+	golden := func() interface{} { return e.Golden }
+	_, result, err := e.run(call{golden: true}, golden, e.Candidate)
+	return result, err
+}
+
+// RunControlOnly runs the Control and returns its value, bypassing the
+// experiment entirely: the Candidate, Enabled, and Publish are not called.
+// If Setup is set, ControlFn is given its result instead. It returns nil if
+// there is no control to run.
+func (e *Experiment) RunControlOnly() interface{} {
+	switch {
+	case e.Setup != nil && e.ControlFn != nil:
+		return e.ControlFn(e.Setup())
+	case e.Control != nil:
+		return e.Control()
+	}
+	return nil
+}
+
+// start runs the experiment for RunValue and RunContext, using Setup and the
+// input variants if Setup is set.
+func (e *Experiment) start(c call) (interface{}, *Result, error) {
+	if e.Setup != nil {
+		c.input = e.Setup()
+		return e.runWith(c)
+	}
+	return e.run(c, e.Control, e.Candidate)
+}
+
+func (e *Experiment) runWith(c call) (interface{}, *Result, error) {
+	var control, candidate ExperimentFunc
+	if e.ControlFn != nil {
+		control = func() interface{} { return e.ControlFn(c.input) }
+	}
+	if e.CandidateFn != nil {
+		candidateInput := c.input
+		if e.InputCloner != nil {
+			c.clone = func() { candidateInput = e.InputCloner(c.input) }
+		}
+		candidate = func() interface{} { return e.CandidateFn(candidateInput) }
+	}
+	return e.run(c, control, candidate)
+}
+
+// call holds the arguments of a single run of an experiment.
+type call struct {
+	ctx    context.Context // nil unless run with RunContext
+	input  interface{}     // input given to RunWith
+	golden bool            // whether the control is a known value, such as Golden, rather than run
+	wait   bool            // whether to wait for the candidate even if Shadow is set
+	shadow bool            // whether the caller has already been given the control's value
+	force  bool            // whether to run the candidate even if the experiment would skip it
+	clone  func()          // prepares the candidate's input, once it is known to run
+	config Config          // the experiment's configuration when the run started
+}
+
+// run carries out the experiment with the given control and candidate. It
+// returns the value for the caller, and the result if the candidate ran.
+func (e *Experiment) run(c call, controlFn, candidateFn ExperimentFunc) (interface{}, *Result, error) {
+	if controlFn == nil {
+		return nil, nil, ErrNoControl
+	}
+	baseline := e.BaselineOnly && !c.golden && !c.force
+	if candidateFn == nil && !baseline {
+		return nil, nil, ErrNoCandidate
 	}
-	if e.Candidate == nil {
-		return ErrNoCandidate
+	comparator := e.comparator()
+	if c.ctx != nil && e.ContextComparator != nil && e.Score == nil {
+		ctx, compare := c.ctx, e.ContextComparator
+		comparator = func(control, candidate interface{}) bool {
+			return compare(ctx, control, candidate)
+		}
 	}
-	if e.Comparator == nil {
-		return ErrNoComparator
+	if comparator == nil && !baseline {
+		return nil, nil, ErrNoComparator
+	}
+
+	e.counters.runs.Add(1)
+	c.config = e.config()
+
+	if reason := e.skipReason(c); reason != "" && !c.golden && !c.force {
+		e.counters.skips.Add(1)
+		if !e.AlwaysPublish {
+			if e.RecoverControl {
+				return e.measured("control", controlFn, true).Value, nil, nil
+			}
+			return controlFn(), nil, nil
+		}
+
+		result := &Result{
+			ID:           newResultID(),
+			Name:         e.Name,
+			Timestamp:    time.Now(),
+			ControlFirst: true,
+			Control:      e.measured("control", controlFn, e.RecoverControl),
+			SkipReason:   reason,
+		}
+		return e.publishControlOnly(c, result)
+	}
+
+	if baseline {
+		e.counters.skips.Add(1)
+		return e.publishControlOnly(c, &Result{
+			ID:           newResultID(),
+			Name:         e.Name,
+			Timestamp:    time.Now(),
+			ControlFirst: true,
+			Control:      e.measured("control", controlFn, e.RecoverControl),
+			SkipReason:   SkipBaseline,
+		})
 	}
 
-	if e.Enabled == nil || !e.Enabled() {
-		e.Control()
-		return nil
+	if c.clone != nil {
+		c.clone()
 	}
 
+	warmup := e.runs.Add(1) <= int64(e.Warmup)
+
+	id := newResultID()
 	ts := time.Now()
+	if e.Shadow && !c.golden && !c.wait {
+		return e.shadow(c, comparator, &Result{ID: id, Name: e.Name, Timestamp: ts, Warmup: warmup}, controlFn, candidateFn)
+	}
+
 	var control *Observation
 	var candidate *Observation
 
-	// Should swallow any panics by Candidate
-	if e.controlRunsFirst() {
-		control = observe(e.Control)
-		candidate = observe(e.Candidate)
+	var stream *stream
+	if e.StreamPublish != nil {
+		stream = e.startStream(id, ts)
+		defer stream.stop()
+		controlFn = stream.track(controlFn, &stream.control)
+		candidateFn = stream.track(candidateFn, &stream.candidate)
+	}
+
+	// Panics in the candidate are recovered, but the control's propagate
+	// unless RecoverControl is set.
+	if c.golden {
+		control = &Observation{Which: "control", Value: controlFn()}
+		candidate = e.observe("candidate", candidateFn, true)
+	} else if e.controlRunsFirst() {
+		control = e.observe("control", controlFn, e.RecoverControl)
+		if reason := e.skipAfterControl(control); reason != "" {
+			e.counters.skips.Add(1)
+			if !e.AlwaysPublish {
+				return control.Value, nil, nil
+			}
+			return e.publishControlOnly(c, &Result{
+				ID:               id,
+				Name:             e.Name,
+				Timestamp:        ts,
+				ControlFirst:     true,
+				Control:          control,
+				Warmup:           warmup,
+				SkipReason:       reason,
+				DeadlineExceeded: reason == SkipDeadline,
+			})
+		}
+		candidate = e.observe("candidate", candidateFn, true)
 	} else {
-		candidate = observe(e.Candidate)
-		control = observe(e.Control)
+		candidate = e.observe("candidate", candidateFn, true)
+		control = e.observe("control", controlFn, e.RecoverControl)
 	}
 
-	matched := e.Comparator(control.Value, candidate.Value)
+	if stream != nil {
+		stream.stop()
+	}
 
-	if e.Publish != nil {
-		result := &Result{
-			Name:         e.Name,
-			Matched:      matched,
-			ControlFirst: e.controlRunsFirst(),
-			Timestamp:    ts,
-			Candidate:    candidate,
-			Control:      control,
+	return e.finish(c, comparator, &Result{
+		ID:           id,
+		Name:         e.Name,
+		ControlFirst: e.controlRunsFirst(),
+		Timestamp:    ts,
+		Candidate:    candidate,
+		Control:      control,
+		Warmup:       warmup,
+	})
+}
+
+// finish compares the observations in the result and publishes it, once both
+// branches have run, returning the value for the caller.
+func (e *Experiment) finish(c call, comparator ComparatorFunc, result *Result) (interface{}, *Result, error) {
+	control, candidate := result.Control, result.Candidate
+	if !result.Warmup && !c.golden {
+		e.durations.add(e.PercentileWindow, control.Duration, candidate.Duration)
+	}
+
+	if total := control.Duration + candidate.Duration; e.Deadline > 0 && !c.golden && total > e.Deadline {
+		e.logf("science: experiment %q: branches took %v, past the %v deadline", e.Name, total, e.Deadline)
+		result.DeadlineExceeded = true
+	}
+
+	if e.DurationBudget > 0 {
+		result.CandidateWithinBudget = candidate.Duration <= e.DurationBudget
+	}
+
+	// A shadow run's comparison is meant to outlive the caller's context.
+	ctx := c.ctx
+	if c.shadow {
+		ctx = nil
+	}
+	e.compare(ctx, comparator, result)
+	if len(e.ExtraControls) > 0 && !c.golden {
+		e.compareExtraControls(ctx, comparator, result)
+	}
+	if result.Compared {
+		// A control that failed says nothing about the candidate.
+		if !control.Panicked && valueError(control.Value) == nil {
+			e.recordCandidate(result.Matched)
 		}
-		e.Publish(result)
+		e.count(result.Matched, candidate.Panicked)
 	}
 
-	return nil
+	value := control.Value
+	result.Returned = "control"
+	if result.Matched && !c.shadow && (e.ReturnCandidate || e.ReturnFaster && candidate.Duration < control.Duration) {
+		value = candidate.Value
+		result.Returned = "candidate"
+	}
+
+	quiet := e.SkipPublishOnMatchedError && result.Compared && result.Matched && sameError(control, candidate)
+	e.prepare(result, c)
+	if !quiet {
+		e.emit(result)
+	}
+
+	if result.Compared && !result.Matched && e.OnMismatch != nil {
+		e.mismatch(result)
+	}
+
+	if e.ErrorOnMismatch && result.Compared && !result.Matched {
+		return value, result, &MismatchError{Result: result}
+	}
+	return value, result, nil
+}
+
+// shadow runs the control and returns its value straight away, leaving the
+// candidate to be run, compared, and published in the background.
+func (e *Experiment) shadow(c call, comparator ComparatorFunc, result *Result, controlFn, candidateFn ExperimentFunc) (interface{}, *Result, error) {
+	c.shadow = true
+	result.ControlFirst = true
+	result.Control = e.observe("control", controlFn, e.RecoverControl)
+	value := result.Control.Value
+
+	if reason := e.skipAfterControl(result.Control); reason != "" {
+		e.counters.skips.Add(1)
+		if e.AlwaysPublish {
+			result.SkipReason = reason
+			result.DeadlineExceeded = reason == SkipDeadline
+			e.publishControlOnly(c, result)
+		}
+		return value, nil, nil
+	}
+
+	candidate := func() {
+		result.Candidate = e.observe("candidate", candidateFn, true)
+		e.finish(c, comparator, result)
+	}
+	if !goBackground(candidate) {
+		candidate()
+	}
+	return value, nil, nil
+}
+
+// skipAfterControl returns the reason the candidate should not be run after
+// the control's observation, if there is one.
+func (e *Experiment) skipAfterControl(control *Observation) string {
+	switch {
+	case e.Deadline > 0 && control.Duration >= e.Deadline:
+		e.logf("science: experiment %q: control took %v, past the %v deadline; candidate skipped", e.Name, control.Duration, e.Deadline)
+		return SkipDeadline
+	case e.SkipCandidateIfControlSlowerThan > 0 && control.Duration > e.SkipCandidateIfControlSlowerThan:
+		return SkipControlSlow
+	}
+	return ""
+}
+
+// publishControlOnly publishes the result of a run in which only the control
+// ran, for AlwaysPublish, and returns the control's value.
+func (e *Experiment) publishControlOnly(c call, result *Result) (interface{}, *Result, error) {
+	value := result.Control.Value
+	result.Returned = "control"
+	e.prepare(result, c)
+	e.emit(result)
+	return value, result, nil
+}
+
+// compare decides whether the candidate's observation in the result matches
+// the control's, setting Matched and Compared. Compared is left false if the
+// control panicked, the pair was excluded from comparison, Clean panicked on
+// the candidate's value, or the comparator failed or timed out, in which case
+// the run is not a mismatch.
+func (e *Experiment) compare(ctx context.Context, comparator ComparatorFunc, result *Result) {
+	control, candidate := result.Control, result.Candidate
+
+	a, b := control.Value, candidate.Value
+	cleaned := true
+	if e.CompareCleaned {
+		a, _ = e.clean(control)
+		b, cleaned = e.clean(candidate)
+	}
+
+	switch {
+	case control.Panicked:
+		e.logf("science: experiment %q: %s panicked: %v", e.Name, control.Which, control.Panic)
+		return
+	case candidate.Panicked:
+		e.logf("science: experiment %q: %s panicked: %v", e.Name, candidate.Which, candidate.Panic)
+	case e.ExpectedType != nil && !(hasType(control.Value, e.ExpectedType) && hasType(candidate.Value, e.ExpectedType)):
+		result.TypeMismatch = true
+	case !cleaned:
+		return
+	case e.SkipCompareIf != nil && e.SkipCompareIf(a, b):
+		return
+	case samePointer(a, b):
+		result.Matched = true
+		if e.Score != nil {
+			result.Score = 1
+		}
+	default:
+		var score float64
+		if e.Score != nil {
+			// Keep the score that decided the match. It is only read once
+			// the comparison has returned.
+			comparator = func(control, candidate interface{}) bool {
+				score = e.Score(control, candidate)
+				return score >= e.ScoreThreshold
+			}
+		}
+		matched, timedOut, cancelled, err := e.callComparator(ctx, comparator, a, b)
+		if timedOut {
+			e.logf("science: experiment %q: comparator timed out after %v", e.Name, e.ComparatorTimeout)
+			result.ComparisonTimedOut = true
+			return
+		}
+		if cancelled {
+			e.logf("science: experiment %q: comparison abandoned: %v", e.Name, ctx.Err())
+			result.ComparisonCancelled = true
+			return
+		}
+		if err != nil {
+			e.logf("science: experiment %q: comparator failed: %v", e.Name, err)
+			result.ComparisonErr = err
+			return
+		}
+		result.Matched = matched
+		result.Score = score
+	}
+	result.Compared = true
+}
+
+// callComparator compares the values with the comparator, giving up once
+// ComparatorTimeout has passed, if it is set, or once ctx is done, if it is
+// not nil. A comparator that is given up on is left to finish in the
+// background, and its answer is discarded. A failure reported by one of this
+// package's comparators is returned as an error; any other panic in the
+// comparator is raised again on the calling goroutine.
+func (e *Experiment) callComparator(ctx context.Context, comparator ComparatorFunc, control, candidate interface{}) (matched, timedOut, cancelled bool, err error) {
+	if ctx != nil && ctx.Err() != nil {
+		return false, false, true, nil
+	}
+	if e.ComparatorTimeout <= 0 && (ctx == nil || ctx.Done() == nil) {
+		matched, err = safeCompare(comparator, control, candidate)
+		return matched, false, false, err
+	}
+
+	type answer struct {
+		matched  bool
+		err      error
+		panicked bool
+		panic    interface{}
+	}
+	done := make(chan answer)
+	abandoned := make(chan struct{})
+	defer close(abandoned)
+	go func() {
+		var a answer
+		defer func() {
+			if p := recover(); p != nil {
+				a = answer{panicked: true, panic: p}
+			}
+			select {
+			case done <- a:
+			case <-abandoned:
+				if a.panicked {
+					e.logf("science: experiment %q: abandoned comparator panicked: %v", e.Name, a.panic)
+				}
+			}
+		}()
+		a.matched, a.err = safeCompare(comparator, control, candidate)
+	}()
+
+	var timeout <-chan time.Time
+	if e.ComparatorTimeout > 0 {
+		timer := time.NewTimer(e.ComparatorTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	var cancel <-chan struct{}
+	if ctx != nil {
+		cancel = ctx.Done()
+	}
+
+	select {
+	case a := <-done:
+		if a.panicked {
+			panic(a.panic)
+		}
+		return a.matched, false, false, a.err
+	case <-timeout:
+		return false, true, false, nil
+	case <-cancel:
+		return false, false, true, nil
+	}
+}
+
+// safeCompare calls the comparator, returning the failure it reports as an
+// error. Comparators with no way to return an error, like
+// JSONCanonicalComparator, report failures by panicking with a compareError;
+// any other panic is a bug in the comparator, and propagates.
+func safeCompare(comparator ComparatorFunc, control, candidate interface{}) (matched bool, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			cerr, ok := p.(compareError)
+			if !ok {
+				panic(p)
+			}
+			err = cerr.error
+		}
+	}()
+	return comparator(control, candidate), nil
+}
+
+// hasType reports whether v can be assigned to a variable of type t.
+func hasType(v interface{}, t reflect.Type) bool {
+	if v == nil {
+		switch t.Kind() {
+		case reflect.Chan, reflect.Func, reflect.Interface, reflect.Map, reflect.Ptr, reflect.Slice:
+			return true
+		}
+		return false
+	}
+	return reflect.TypeOf(v).AssignableTo(t)
+}
+
+// skipReason returns why only the control should be run for c, or "" if the
+// candidate should run too.
+func (e *Experiment) skipReason(c call) string {
+	switch {
+	case Disabled():
+		return SkipDisabled
+	case e.Paused():
+		return SkipPaused
+	case e.breakerTripped():
+		return SkipBreaker
+	case !e.enabled(c):
+		return SkipNotEnabled
+	case !e.sampled():
+		return SkipNotSampled
+	}
+	return ""
+}
+
+// prepare readies the result for publishing, recording the input and
+// cleaning, hashing, discarding, or redacting the observed values. It must be
+// called after the values have been compared and the caller's value chosen.
+func (e *Experiment) prepare(result *Result, c call) {
+	result.CallerFile, result.CallerLine = e.CallerFile, e.CallerLine
+	result.Config = c.config
+	if c.input != nil {
+		result.Input = c.input
+		if e.CleanInput != nil {
+			result.Input = e.CleanInput(c.input)
+		}
+	}
+
+	observations := []*Observation{result.Control, result.Candidate}
+	for _, name := range sortedNames(result.ExtraControls) {
+		observations = append(observations, result.ExtraControls[name])
+	}
+
+	for _, o := range observations {
+		if o == nil {
+			continue
+		}
+		if v, ok := e.clean(o); ok {
+			o.Value = v
+		} else {
+			o.Value = nil
+		}
+		if e.HashValues {
+			o.Hash = hashValue(o.Value)
+		}
+		if e.DiscardValues {
+			o.Value = nil
+		} else if e.Redact {
+			o.Value = redact(o.Value)
+		}
+	}
+}
+
+// clean returns the observation's value passed through Clean, or the value
+// as it is if there is no Clean, the branch panicked, or the value is not of
+// the ExpectedType. A panic in Clean on any branch but the control is
+// recovered and logged, and ok is false.
+func (e *Experiment) clean(o *Observation) (v interface{}, ok bool) {
+	if e.Clean == nil || o.Panicked || e.ExpectedType != nil && !hasType(o.Value, e.ExpectedType) {
+		return o.Value, true
+	}
+	if o.Which != "control" {
+		defer func() {
+			if p := recover(); p != nil {
+				e.logf("science: experiment %q: Clean panicked on the value of %q: %v", e.Name, o.Which, p)
+				v, ok = nil, false
+			}
+		}()
+	}
+	return e.Clean(o.Value), true
+}
+
+// emit passes the result through ResultFilter, then sends it on the Events
+// channel and passes it to Publish, in the background if the experiment is
+// Async.
+func (e *Experiment) emit(result *Result) {
+	if e.ResultFilter != nil {
+		if result = e.filter(result); result == nil {
+			return
+		}
+	}
+
+	e.sendEvent(result)
+	if onRun := OnRun; onRun != nil {
+		e.onRun(onRun, result)
+	}
+	publish := e.publishFunc()
+	if publish == nil {
+		return
+	}
+	if !e.Async || !goBackground(func() { e.publishBackground(publish, result) }) {
+		e.publish(publish, result)
+	}
+}
+
+// filter calls ResultFilter, dropping the result if it panics.
+func (e *Experiment) filter(result *Result) (filtered *Result) {
+	defer func() {
+		if p := recover(); p != nil {
+			e.logf("science: experiment %q: ResultFilter panicked: %v", e.Name, p)
+			filtered = nil
+		}
+	}()
+	return e.ResultFilter(result)
+}
+
+// onRun calls OnRun, recovering any panic.
+func (e *Experiment) onRun(onRun func(*Result), result *Result) {
+	defer func() {
+		if p := recover(); p != nil {
+			e.logf("science: experiment %q: OnRun panicked: %v", e.Name, p)
+		}
+	}()
+	onRun(result)
+}
+
+// Pause stops the experiment running its candidate until Resume is called,
+// whatever Enabled says. It is safe to call while the experiment is running.
+func (e *Experiment) Pause() {
+	e.paused.Store(true)
+}
+
+// Resume undoes Pause.
+func (e *Experiment) Resume() {
+	e.paused.Store(false)
+}
+
+// Paused reports whether the experiment has been paused.
+func (e *Experiment) Paused() bool {
+	return e.paused.Load()
+}
+
+// SetPublish replaces the experiment's Publish function. Unlike assigning to
+// Publish, it is safe to call while the experiment is running, for example
+// to redirect results from an admin endpoint. Once SetPublish has been
+// called, the Publish field is ignored.
+func (e *Experiment) SetPublish(f PublishFunc) {
+	e.livePublish.Store(&f)
+}
+
+// SetEnabled replaces the experiment's Enabled function, as SetPublish does
+// for Publish. Once SetEnabled has been called, the Enabled field is
+// ignored.
+func (e *Experiment) SetEnabled(f EnabledFunc) {
+	e.liveEnabled.Store(&f)
+}
+
+// publishFunc returns the Publish function given to SetPublish, or the
+// Publish field if SetPublish has not been called.
+func (e *Experiment) publishFunc() PublishFunc {
+	if f := e.livePublish.Load(); f != nil {
+		return *f
+	}
+	return e.Publish
+}
+
+// enabledFunc returns the Enabled function given to SetEnabled, or the
+// Enabled field if SetEnabled has not been called.
+func (e *Experiment) enabledFunc() EnabledFunc {
+	if f := e.liveEnabled.Load(); f != nil {
+		return *f
+	}
+	return e.Enabled
+}
+
+// enabled reports whether the candidate should be run for c.
+func (e *Experiment) enabled(c call) bool {
+	if c.ctx != nil && e.ContextEnabled != nil {
+		return e.ContextEnabled(c.ctx)
+	}
+	enabled := e.enabledFunc()
+	return enabled != nil && enabled()
+}
+
+// samePointer reports whether a and b are the same non-nil pointer, in which
+// case they match without needing to call the comparator.
+func samePointer(a, b interface{}) bool {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	return va.Kind() == reflect.Ptr && vb.Kind() == reflect.Ptr && va.Type() == vb.Type() &&
+		!va.IsNil() && va.Pointer() == vb.Pointer()
+}
+
+// comparator returns the ScoreComparator for the experiment's Score if it has
+// one, or the comparator registered as its ComparatorName if it has one, or
+// its Comparator, or DefaultComparator if it has none of them.
+func (e *Experiment) comparator() ComparatorFunc {
+	if e.Score != nil {
+		return ScoreComparator(e.Score, e.ScoreThreshold)
+	}
+	if e.ComparatorName != "" {
+		return ComparatorByName(e.ComparatorName)
+	}
+	if e.Comparator != nil {
+		return e.Comparator
+	}
+	return DefaultComparator
 }
 
 func (e *Experiment) controlRunsFirst() bool {
-	return true
+	return e.controlFirst || e.SkipCandidateIfControlSlowerThan > 0
+}
+
+// publish sends the result to publish, giving up after PublishTimeout if one
+// is set. A panic in publish is passed on to the caller if it happens before
+// the timeout, and logged otherwise.
+func (e *Experiment) publish(publish PublishFunc, result *Result) {
+	if e.PublishTimeout <= 0 {
+		publish(result)
+		return
+	}
+
+	done := make(chan interface{}, 1)
+	go func() {
+		defer func() {
+			done <- recover()
+		}()
+		publish(result)
+	}()
+
+	timer := time.NewTimer(e.PublishTimeout)
+	defer timer.Stop()
+
+	select {
+	case p := <-done:
+		if p != nil {
+			panic(p)
+		}
+	case <-timer.C:
+		e.logf("science: experiment %q: publish timed out after %v", e.Name, e.PublishTimeout)
+		go func() {
+			if p := <-done; p != nil {
+				e.logf("science: experiment %q: publish panicked: %v", e.Name, p)
+			}
+		}()
+	}
+}
+
+// publishBackground publishes the result for an Async experiment, logging
+// any panic as there is no caller to pass it to.
+func (e *Experiment) publishBackground(publish PublishFunc, result *Result) {
+	defer func() {
+		if p := recover(); p != nil {
+			e.logf("science: experiment %q: publish panicked: %v", e.Name, p)
+		}
+	}()
+	e.publish(publish, result)
+}
+
+// mismatch calls OnMismatch, recovering and logging any panic.
+func (e *Experiment) mismatch(result *Result) {
+	defer func() {
+		if p := recover(); p != nil {
+			e.logf("science: experiment %q: mismatch handler panicked: %v", e.Name, p)
+		}
+	}()
+	e.OnMismatch(result)
+}
+
+// redact returns a placeholder for v that gives its type, and its length if
+// it has one.
+func redact(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Array, reflect.Chan, reflect.Map, reflect.Slice, reflect.String:
+		return fmt.Sprintf("[redacted %T len=%d]", v, rv.Len())
+	}
+	return fmt.Sprintf("[redacted %T]", v)
+}
+
+func (e *Experiment) logf(format string, v ...interface{}) {
+	if e.Logger != nil {
+		e.Logger.Printf(format, v...)
+	}
+}
+
+// beforeObserve calls BeforeObserve, if set, for the observation.
+func (e *Experiment) beforeObserve(o *Observation) {
+	e.callObserveHook("BeforeObserve", e.BeforeObserve, o)
 }
 
-func observe(f func() interface{}) *Observation {
-	start := time.Now()
+// afterObserve calls AfterObserve, if set, for the observation.
+func (e *Experiment) afterObserve(o *Observation) {
+	e.callObserveHook("AfterObserve", e.AfterObserve, o)
+}
+
+func (e *Experiment) callObserveHook(name string, hook func(string, *Observation), o *Observation) {
+	if hook == nil {
+		return
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			e.logf("science: experiment %q: %s panicked: %v", e.Name, name, p)
+		}
+	}()
+
+	if o.Extra == nil {
+		o.Extra = make(map[string]interface{})
+	}
+	hook(o.Which, o)
+}
 
-	val := f()
+// observe runs f, the branch called which, and records its duration and
+// value, calling BeforeObserve and AfterObserve around it. AfterObserve is
+// called even if f panics. If recoverPanics is set, a panic in f is recorded
+// in the observation instead of propagating.
+func (e *Experiment) observe(which string, f func() interface{}, recoverPanics bool) *Observation {
+	o := &Observation{Which: which}
+	e.beforeObserve(o)
+	defer e.afterObserve(o)
+	e.measure(o, f, recoverPanics)
+	return o
+}
+
+// measured runs f like observe, but without calling BeforeObserve and
+// AfterObserve, for runs in which the candidate is skipped.
+func (e *Experiment) measured(which string, f func() interface{}, recoverPanics bool) *Observation {
+	o := &Observation{Which: which}
+	e.measure(o, f, recoverPanics)
+	return o
+}
 
-	duration := time.Since(start)
+// measure runs f, recording the results in o.
+func (e *Experiment) measure(o *Observation, f func() interface{}, recoverPanics bool) {
+	var capture func() []string
+	if e.LogCapture != nil {
+		capture = e.LogCapture()
+	}
+
+	if e.MeasureCPU {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		if before, ok := threadCPUTime(); ok {
+			defer func() {
+				if after, ok := threadCPUTime(); ok {
+					o.CPUTime = after - before
+				}
+			}()
+		}
+	}
+
+	o.Start = time.Now()
+
+	defer func() {
+		o.End = time.Now()
+		o.Duration = o.End.Sub(o.Start)
+		if capture != nil {
+			o.Logs = capture()
+		}
+	}()
+
+	if recoverPanics {
+		defer func() {
+			if p := recover(); p != nil {
+				o.Panicked = true
+				o.Panic = p
+			}
+		}()
+	}
 
-	return &Observation{
-		Duration: duration,
-		Value:    val}
+	o.Value = f()
 }
 
 func init() {
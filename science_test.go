@@ -1,7 +1,17 @@
 package science
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestExperimentChecksFunctions(t *testing.T) {
@@ -20,12 +30,43 @@ func TestExperimentChecksFunctions(t *testing.T) {
 
 	e.Candidate = func() interface{} { return nil }
 	e.Comparator = nil
+	defer func(c ComparatorFunc) { DefaultComparator = c }(DefaultComparator)
+	DefaultComparator = nil
 	err = e.Run()
 	if err != ErrNoComparator {
 		t.Fatal("expected comparator to be required")
 	}
 }
 
+func TestExperimentUsesDefaults(t *testing.T) {
+	defer func(c ComparatorFunc, p PublishFunc) {
+		DefaultComparator, DefaultPublish = c, p
+	}(DefaultComparator, DefaultPublish)
+
+	var published *Result
+	DefaultComparator = func(a, b interface{}) bool { return true }
+	DefaultPublish = func(r *Result) { published = r }
+
+	e := NewExperiment("test")
+	e.Control = func() interface{} { return 1 }
+	e.Candidate = func() interface{} { return 2 }
+	e.Run()
+
+	if published == nil || !published.Matched {
+		t.Fatal("expected the default comparator and publisher to be used")
+	}
+
+	published = nil
+	e.Comparator = nil
+	if err := e.Run(); err != nil {
+		t.Fatalf("expected a nil comparator to fall back to the default, got %v", err)
+	}
+
+	if !published.Matched {
+		t.Fatal("expected the default comparator to be used")
+	}
+}
+
 func TestExperimentRunsControlIfNotEnabled(t *testing.T) {
 	var ran = false
 
@@ -123,3 +164,1783 @@ func TestExperimentPublishesFailure(t *testing.T) {
 		t.Fatal("expected published results to be a mismatch")
 	}
 }
+
+type testLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *testLogger) Printf(format string, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func (l *testLogger) Lines() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.lines...)
+}
+
+func TestExperimentPublishTimeout(t *testing.T) {
+	e := NewExperiment("test")
+	e.Control = func() interface{} { return 42 }
+	e.Candidate = func() interface{} { return 42 }
+
+	block := make(chan struct{})
+	defer close(block)
+	e.Publish = func(*Result) { <-block }
+
+	logger := &testLogger{}
+	e.Logger = logger
+	e.PublishTimeout = 10 * time.Millisecond
+
+	done := make(chan error)
+	go func() { done <- e.Run() }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected run to return after the publish timeout")
+	}
+
+	if len(logger.Lines()) != 1 {
+		t.Fatal("expected the publish timeout to be logged")
+	}
+}
+
+func TestExperimentRunValueReturnsControl(t *testing.T) {
+	e := NewExperiment("test")
+	e.Control = func() interface{} { return 42 }
+	e.Candidate = func() interface{} { return 42 }
+
+	var result *Result
+	e.Publish = func(r *Result) { result = r }
+
+	v, err := e.RunValue()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if v.(int) != 42 {
+		t.Fatal("expected the control value to be returned")
+	}
+
+	if result.Returned != "control" {
+		t.Fatalf("expected result to record the control was returned, got %q", result.Returned)
+	}
+}
+
+func TestExperimentReturnCandidate(t *testing.T) {
+	e := NewExperiment("test")
+	e.ReturnCandidate = true
+	e.Control = func() interface{} { return []int{1} }
+	e.Candidate = func() interface{} { return []int{1} }
+
+	var result *Result
+	e.Publish = func(r *Result) { result = r }
+
+	e.RunValue()
+	if result.Returned != "candidate" {
+		t.Fatal("expected the matching candidate value to be returned")
+	}
+
+	e.Candidate = func() interface{} { return []int{2} }
+	v, _ := e.RunValue()
+	if v.([]int)[0] != 1 || result.Returned != "control" {
+		t.Fatal("expected the control value to be returned on mismatch")
+	}
+}
+
+func TestExperimentReturnFaster(t *testing.T) {
+	slow := "control"
+	branch := func(name string) ExperimentFunc {
+		return func() interface{} {
+			if name == slow {
+				time.Sleep(2 * time.Millisecond)
+			}
+			return name
+		}
+	}
+
+	e := NewExperiment("test")
+	e.ReturnFaster = true
+	e.Control = branch("control")
+	e.Candidate = branch("candidate")
+	e.Comparator = func(a, b interface{}) bool { return true }
+
+	if v, _ := e.RunValue(); v != "candidate" {
+		t.Fatalf("expected the faster candidate's value, got %v", v)
+	}
+
+	slow = "candidate"
+	if v, _ := e.RunValue(); v != "control" {
+		t.Fatalf("expected the faster control's value, got %v", v)
+	}
+
+	slow = "control"
+	e.Comparator = func(a, b interface{}) bool { return false }
+	if v, _ := e.RunValue(); v != "control" {
+		t.Fatalf("expected the control's value on a mismatch, got %v", v)
+	}
+}
+
+func TestExperimentWarmup(t *testing.T) {
+	e := NewExperiment("test")
+	e.Warmup = 2
+	e.Control = func() interface{} { return 42 }
+	e.Candidate = func() interface{} { return 42 }
+
+	var warmups []bool
+	e.Publish = func(r *Result) { warmups = append(warmups, r.Warmup) }
+
+	for i := 0; i < 3; i++ {
+		e.Run()
+	}
+
+	if !warmups[0] || !warmups[1] || warmups[2] {
+		t.Fatalf("expected only the first two runs to be warmups, got %v", warmups)
+	}
+}
+
+func TestExperimentOnMismatch(t *testing.T) {
+	e := NewExperiment("test")
+	e.Control = func() interface{} { return 42 }
+	e.Candidate = func() interface{} { return 42 }
+
+	calls := 0
+	e.OnMismatch = func(*Result) {
+		calls++
+		panic("boom")
+	}
+	logger := &testLogger{}
+	e.Logger = logger
+
+	e.Run()
+	if calls != 0 {
+		t.Fatal("expected OnMismatch not to be called for a match")
+	}
+
+	e.Candidate = func() interface{} { return 43 }
+	if err := e.Run(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if calls != 1 {
+		t.Fatal("expected OnMismatch to be called for a mismatch")
+	}
+
+	if len(logger.Lines()) != 1 {
+		t.Fatal("expected the OnMismatch panic to be logged")
+	}
+}
+
+func TestExperimentRunsControlFirstByDefault(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		e := NewExperiment("test")
+		e.Control = func() interface{} { return 1 }
+		e.Candidate = func() interface{} { return 1 }
+
+		var result *Result
+		e.Publish = func(r *Result) { result = r }
+		e.Run()
+		if !result.ControlFirst {
+			t.Fatal("expected the control to run first unless SetDeterministicOrder says otherwise")
+		}
+	}
+}
+
+func TestSetDeterministicOrder(t *testing.T) {
+	defer ClearDeterministicOrder()
+
+	for _, controlFirst := range []bool{true, false} {
+		SetDeterministicOrder(controlFirst)
+
+		for i := 0; i < 10; i++ {
+			var ran []string
+			e := NewExperiment("test")
+			e.Control = func() interface{} {
+				ran = append(ran, "control")
+				return nil
+			}
+			e.Candidate = func() interface{} {
+				ran = append(ran, "candidate")
+				return nil
+			}
+
+			var result *Result
+			e.Publish = func(r *Result) { result = r }
+			e.Run()
+
+			if result.ControlFirst != controlFirst || (ran[0] == "control") != controlFirst {
+				t.Fatalf("expected control first to be %v, ran %v", controlFirst, ran)
+			}
+		}
+	}
+}
+
+func TestExperimentClone(t *testing.T) {
+	e := NewExperiment("test")
+	e.Warmup = 1
+	e.Control = func() interface{} { return 1 }
+	e.Candidate = func() interface{} { return 1 }
+
+	var warmup bool
+	e.Publish = func(r *Result) { warmup = r.Warmup }
+	e.Run()
+
+	c := e.Clone()
+	c.Candidate = func() interface{} { return 2 }
+
+	var matched = true
+	c.Publish = func(r *Result) {
+		warmup = r.Warmup
+		matched = r.Matched
+	}
+	c.Run()
+
+	if c.Name != "test" || c.Warmup != 1 {
+		t.Fatal("expected the clone to copy the configuration")
+	}
+
+	if !warmup {
+		t.Fatal("expected the clone not to share the run count")
+	}
+
+	if matched {
+		t.Fatal("expected the clone to use its own candidate")
+	}
+
+	e.Publish = func(r *Result) { matched = r.Matched }
+	e.Run()
+	if !matched {
+		t.Fatal("expected the original to be unaffected by the clone")
+	}
+}
+
+func TestExperimentCloneCopiesAllConfiguration(t *testing.T) {
+	e := &Experiment{}
+	v := reflect.ValueOf(e).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		if !f.CanSet() {
+			continue
+		}
+		switch f.Kind() {
+		case reflect.Func:
+			f.Set(reflect.MakeFunc(f.Type(), func([]reflect.Value) []reflect.Value { return nil }))
+		case reflect.Bool:
+			f.SetBool(true)
+		case reflect.Int, reflect.Int64:
+			f.SetInt(1)
+		case reflect.Float64:
+			f.SetFloat(1)
+		case reflect.String:
+			f.SetString("x")
+		case reflect.Map:
+			f.Set(reflect.MakeMap(f.Type()))
+		case reflect.Interface:
+			for _, v := range []interface{}{&testLogger{}, reflect.TypeOf(0), 1} {
+				if reflect.TypeOf(v).AssignableTo(f.Type()) {
+					f.Set(reflect.ValueOf(v))
+					break
+				}
+			}
+		default:
+			t.Fatalf("unhandled field %s", v.Type().Field(i).Name)
+		}
+	}
+
+	c := reflect.ValueOf(e.Clone()).Elem()
+	for i := 0; i < c.NumField(); i++ {
+		if v.Field(i).CanSet() && c.Field(i).IsZero() {
+			t.Errorf("expected Clone to copy %s", c.Type().Field(i).Name)
+		}
+	}
+}
+
+func TestSetDisabled(t *testing.T) {
+	SetDisabled(true)
+	defer SetDisabled(false)
+
+	candidateRan := false
+	e := NewExperiment("test")
+	e.Control = func() interface{} { return 42 }
+	e.Candidate = func() interface{} {
+		candidateRan = true
+		return 42
+	}
+
+	v, err := e.RunValue()
+	if err != nil || v.(int) != 42 {
+		t.Fatal("expected the control to run while disabled")
+	}
+
+	if candidateRan {
+		t.Fatal("expected the candidate not to run while disabled")
+	}
+}
+
+func TestExperimentRunWith(t *testing.T) {
+	e := NewExperiment("test")
+
+	if _, err := e.RunWith(1); err != ErrNoControl {
+		t.Fatal("expected ControlFn to be required")
+	}
+
+	e.ControlFn = func(in interface{}) interface{} { return in.(int) * 2 }
+	if _, err := e.RunWith(1); err != ErrNoCandidate {
+		t.Fatal("expected CandidateFn to be required")
+	}
+
+	e.CandidateFn = func(in interface{}) interface{} { return in.(int) + in.(int) }
+	v, err := e.RunWith(21)
+	if err != nil || v.(int) != 42 {
+		t.Fatal("expected the control value for the input to be returned")
+	}
+}
+
+func TestExperimentRunTable(t *testing.T) {
+	e := NewExperiment("test")
+	e.ControlFn = func(in interface{}) interface{} { return in.(int) * in.(int) }
+	e.CandidateFn = func(in interface{}) interface{} {
+		n := in.(int)
+		if n == 3 {
+			return 0
+		}
+		return n * n
+	}
+
+	results := e.RunTable([]interface{}{1, 2, 3})
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(results))
+	}
+
+	for i, matched := range []bool{true, true, false} {
+		if results[i].Matched != matched {
+			t.Fatalf("expected result %d matched to be %v", i, matched)
+		}
+	}
+
+	if results[1].Control.Value.(int) != 4 {
+		t.Fatal("expected results to be in input order")
+	}
+}
+
+func TestExperimentRecoverControl(t *testing.T) {
+	e := NewExperiment("test")
+	e.RecoverControl = true
+	e.ControlFn = func(in interface{}) interface{} {
+		if in.(int) == 2 {
+			panic("bad row")
+		}
+		return in
+	}
+	e.CandidateFn = func(in interface{}) interface{} { return in }
+
+	results := e.RunTable([]interface{}{1, 2, 3})
+	if len(results) != 3 {
+		t.Fatalf("expected every input to run, got %d results", len(results))
+	}
+
+	bad := results[1]
+	if !bad.Control.Panicked || bad.Control.Panic != "bad row" {
+		t.Fatal("expected the control panic to be recorded")
+	}
+	if bad.Compared {
+		t.Fatal("expected a run whose control panicked not to be compared")
+	}
+
+	if !results[2].Matched {
+		t.Fatal("expected later inputs to run normally")
+	}
+
+	if e.Stats().Mismatches != 0 {
+		t.Fatal("expected a control panic not to count as a mismatch")
+	}
+}
+
+func TestExperimentControlPanicsPropagate(t *testing.T) {
+	e := NewExperiment("test")
+	e.Control = func() interface{} { panic("control") }
+	e.Candidate = func() interface{} { return 1 }
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected the control panic to propagate by default")
+		}
+	}()
+	e.Run()
+}
+
+func TestExperimentDeadlineSkipsCandidate(t *testing.T) {
+	defer ClearDeterministicOrder()
+	SetDeterministicOrder(true)
+
+	candidateRan := false
+	e := NewExperiment("test")
+	e.Deadline = 5 * time.Millisecond
+	e.AlwaysPublish = true
+	e.Control = func() interface{} {
+		time.Sleep(10 * time.Millisecond)
+		return 1
+	}
+	e.Candidate = func() interface{} {
+		candidateRan = true
+		return 1
+	}
+
+	var result *Result
+	e.Publish = func(r *Result) { result = r }
+	if v, _ := e.RunValue(); v != 1 {
+		t.Fatal("expected the control to run to completion")
+	}
+
+	if candidateRan {
+		t.Fatal("expected the candidate to be skipped once the deadline had passed")
+	}
+	if result.SkipReason != SkipDeadline || !result.DeadlineExceeded || result.Candidate != nil {
+		t.Fatal("expected the result to record the skipped candidate")
+	}
+	if e.Stats().Skips != 1 {
+		t.Fatal("expected the run to count as a skip")
+	}
+}
+
+func TestExperimentSkipCandidateIfControlSlow(t *testing.T) {
+	defer ClearDeterministicOrder()
+	SetDeterministicOrder(false)
+
+	candidateRan := false
+	delay := 10 * time.Millisecond
+	e := NewExperiment("test")
+	e.SkipCandidateIfControlSlowerThan = 5 * time.Millisecond
+	e.AlwaysPublish = true
+	e.Control = func() interface{} {
+		time.Sleep(delay)
+		return 1
+	}
+	e.Candidate = func() interface{} {
+		candidateRan = true
+		return 1
+	}
+
+	var result *Result
+	e.Publish = func(r *Result) { result = r }
+	e.Run()
+
+	if candidateRan || result.SkipReason != SkipControlSlow || result.DeadlineExceeded {
+		t.Fatal("expected the candidate to be skipped after a slow control")
+	}
+
+	delay = 0
+	e.Run()
+	if !candidateRan || !result.Matched || !result.ControlFirst {
+		t.Fatal("expected the candidate to run after the control when it is fast")
+	}
+}
+
+func TestExperimentSkipCandidateIfControlSlowInShadow(t *testing.T) {
+	var candidateRan atomic.Bool
+	delay := 10 * time.Millisecond
+	e := NewExperiment("test")
+	e.Shadow = true
+	e.SkipCandidateIfControlSlowerThan = 5 * time.Millisecond
+	e.AlwaysPublish = true
+	e.Control = func() interface{} {
+		time.Sleep(delay)
+		return 1
+	}
+	e.Candidate = func() interface{} {
+		candidateRan.Store(true)
+		return 1
+	}
+
+	results := make(chan *Result, 1)
+	e.Publish = func(r *Result) { results <- r }
+	if v, err := e.RunValue(); err != nil || v != 1 {
+		t.Fatal("expected the control's value")
+	}
+
+	if r := <-results; candidateRan.Load() || r.SkipReason != SkipControlSlow || r.Candidate != nil {
+		t.Fatal("expected the candidate to be skipped after a slow control in Shadow mode")
+	}
+
+	delay = 0
+	e.Run()
+	select {
+	case r := <-results:
+		if !candidateRan.Load() || !r.Matched {
+			t.Fatal("expected the candidate to run in the background when the control is fast")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected a result once the candidate finished")
+	}
+}
+
+func TestExperimentDeadlineExceeded(t *testing.T) {
+	defer ClearDeterministicOrder()
+	SetDeterministicOrder(false)
+
+	e := NewExperiment("test")
+	e.Deadline = 5 * time.Millisecond
+	e.Control = func() interface{} {
+		time.Sleep(10 * time.Millisecond)
+		return 1
+	}
+	e.Candidate = func() interface{} { return 1 }
+
+	var result *Result
+	e.Publish = func(r *Result) { result = r }
+	e.Run()
+
+	if !result.Matched || !result.DeadlineExceeded {
+		t.Fatal("expected a candidate that ran first to be compared and the deadline to be reported")
+	}
+
+	e.Deadline = time.Minute
+	e.Run()
+	if result.DeadlineExceeded {
+		t.Fatal("expected a run within the deadline not to be marked")
+	}
+}
+
+func TestExperimentAfterObserve(t *testing.T) {
+	e := NewExperiment("test")
+	e.Control = func() interface{} { return 1 }
+	e.Candidate = func() interface{} { return 1 }
+	e.AfterObserve = func(branch string, o *Observation) {
+		o.Extra["branch"] = branch
+		o.Extra["cache hit"] = branch == "candidate"
+	}
+
+	var result *Result
+	e.Publish = func(r *Result) { result = r }
+	e.Run()
+
+	if result.Control.Extra["branch"] != "control" || result.Control.Extra["cache hit"] != false {
+		t.Fatalf("expected the control's extra fields, got %v", result.Control.Extra)
+	}
+	if result.Candidate.Extra["branch"] != "candidate" || result.Candidate.Extra["cache hit"] != true {
+		t.Fatalf("expected the candidate's extra fields, got %v", result.Candidate.Extra)
+	}
+
+	logger := &testLogger{}
+	e.Logger = logger
+	e.AfterObserve = func(string, *Observation) { panic("boom") }
+	if v, err := e.RunValue(); err != nil || v != 1 {
+		t.Fatal("expected a panic in AfterObserve not to affect the run")
+	}
+	if len(logger.Lines()) != 2 {
+		t.Fatalf("expected the panics to be logged, got %v", logger.Lines())
+	}
+}
+
+func TestExperimentObserveHooksSkippedRuns(t *testing.T) {
+	e := NewExperiment("test")
+	e.RecoverControl = true
+	e.Enabled = func() bool { return false }
+	e.Control = func() interface{} { return 1 }
+	e.Candidate = func() interface{} { return 1 }
+	hook := func(string, *Observation) { t.Fatal("expected no hooks on a skipped run") }
+	e.BeforeObserve, e.AfterObserve = hook, hook
+
+	if v, _ := e.RunValue(); v != 1 {
+		t.Fatalf("expected the control's value, got %v", v)
+	}
+
+	e.AlwaysPublish = true
+	e.Publish = func(*Result) {}
+	e.RunValue()
+
+	e.Enabled = nil
+	e.BaselineOnly = true
+	e.RunValue()
+}
+
+func TestExperimentAfterObserveControlPanic(t *testing.T) {
+	e := NewExperiment("test")
+	e.Control = func() interface{} { panic("control broke") }
+	e.Candidate = func() interface{} { return 1 }
+	var after []string
+	e.AfterObserve = func(branch string, o *Observation) { after = append(after, branch) }
+	e.Publish = func(*Result) {}
+
+	func() {
+		defer func() {
+			if p := recover(); p != "control broke" {
+				t.Fatalf("expected the control panic to propagate, got %v", p)
+			}
+		}()
+		e.Run()
+	}()
+
+	if len(after) == 0 || after[len(after)-1] != "control" {
+		t.Fatalf("expected AfterObserve to be called for the panicking control, got %v", after)
+	}
+}
+
+func TestExperimentLogCapture(t *testing.T) {
+	var logs []string
+	logf := func(s string) { logs = append(logs, s) }
+
+	e := NewExperiment("test")
+	e.Control = func() interface{} {
+		logf("control")
+		return nil
+	}
+	e.Candidate = func() interface{} {
+		logf("candidate")
+		return nil
+	}
+	e.LogCapture = func() func() []string {
+		logs = nil
+		return func() []string { return logs }
+	}
+
+	var result *Result
+	e.Publish = func(r *Result) { result = r }
+	e.Run()
+
+	if len(result.Control.Logs) != 1 || result.Control.Logs[0] != "control" {
+		t.Fatalf("expected control logs to be captured, got %v", result.Control.Logs)
+	}
+
+	if len(result.Candidate.Logs) != 1 || result.Candidate.Logs[0] != "candidate" {
+		t.Fatalf("expected candidate logs to be captured, got %v", result.Candidate.Logs)
+	}
+}
+
+func TestExperimentRunControlOnly(t *testing.T) {
+	e := NewExperiment("test")
+	e.Control = func() interface{} { return 42 }
+	e.Candidate = func() interface{} {
+		t.Fatal("expected candidate not to run")
+		return nil
+	}
+	e.Enabled = func() bool {
+		t.Fatal("expected enabled not to be checked")
+		return true
+	}
+	e.Publish = func(*Result) { t.Fatal("expected nothing to be published") }
+
+	if v := e.RunControlOnly(); v.(int) != 42 {
+		t.Fatal("expected the control value to be returned")
+	}
+}
+
+func TestExperimentResultInput(t *testing.T) {
+	e := NewExperiment("test")
+	e.ControlFn = func(in interface{}) interface{} { return len(in.(string)) }
+	e.CandidateFn = func(in interface{}) interface{} { return len(in.(string)) }
+
+	var result *Result
+	e.Publish = func(r *Result) { result = r }
+
+	e.RunWith("secret")
+	if result.Input.(string) != "secret" {
+		t.Fatal("expected the result to contain the input")
+	}
+
+	e.CleanInput = func(interface{}) interface{} { return "[cleaned]" }
+	e.RunWith("secret")
+	if result.Input.(string) != "[cleaned]" {
+		t.Fatal("expected the result input to be cleaned")
+	}
+}
+
+func TestExperimentRedact(t *testing.T) {
+	e := NewExperiment("test")
+	e.Redact = true
+	e.Control = func() interface{} { return "123-45-6789" }
+	e.Candidate = func() interface{} { return "123-45-6789" }
+
+	var result *Result
+	e.Publish = func(r *Result) { result = r }
+
+	v, _ := e.RunValue()
+	if v.(string) != "123-45-6789" {
+		t.Fatal("expected the real value to be returned")
+	}
+
+	if !result.Matched {
+		t.Fatal("expected the real values to be compared")
+	}
+
+	if result.Control.Value != "[redacted string len=11]" || result.Candidate.Value != "[redacted string len=11]" {
+		t.Fatalf("expected published values to be redacted, got %v", result.Control.Value)
+	}
+}
+
+func TestExperimentShadow(t *testing.T) {
+	release := make(chan struct{})
+	results := make(chan *Result, 1)
+
+	e := NewExperiment("test")
+	e.Shadow = true
+	e.ReturnCandidate = true
+	e.Control = func() interface{} { return 1 }
+	e.Candidate = func() interface{} {
+		<-release
+		return 1
+	}
+	e.Publish = func(r *Result) { results <- r }
+
+	if v, err := e.RunValue(); err != nil || v != 1 {
+		t.Fatal("expected the control's value without waiting for the candidate")
+	}
+	close(release)
+
+	select {
+	case r := <-results:
+		if !r.Matched || r.Candidate.Value != 1 || r.Returned != "control" {
+			t.Fatal("expected the candidate to be compared in the background")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected a result once the candidate finished")
+	}
+}
+
+func TestExperimentShadowIgnoredByRunTable(t *testing.T) {
+	e := NewExperiment("test")
+	e.Shadow = true
+	e.ControlFn = func(in interface{}) interface{} { return in }
+	e.CandidateFn = func(in interface{}) interface{} { return in }
+
+	results := e.RunTable([]interface{}{1, 2})
+	if results[0] == nil || !results[1].Matched {
+		t.Fatal("expected RunTable to wait for the candidate")
+	}
+}
+
+func TestExperimentCaptureCaller(t *testing.T) {
+	e := NewExperiment("test")
+	if e.CallerFile != "" {
+		t.Fatal("expected the caller not to be captured by default")
+	}
+
+	CaptureCaller = true
+	defer func() { CaptureCaller = false }()
+
+	_, file, line, _ := runtime.Caller(0)
+	e = NewExperiment("test")
+	if e.CallerFile != file || e.CallerLine != line+1 {
+		t.Fatalf("expected the caller to be %s:%d, got %s:%d", file, line+1, e.CallerFile, e.CallerLine)
+	}
+
+	e.Control = func() interface{} { return 1 }
+	e.Candidate = func() interface{} { return 1 }
+
+	var result *Result
+	e.Publish = func(r *Result) { result = r }
+	e.Run()
+	if result.CallerFile != file || result.CallerLine != line+1 {
+		t.Fatal("expected the caller to be copied to the result")
+	}
+
+	_, _, line, _ = runtime.Caller(0)
+	n := NewNumericExperiment("test", 0.1)
+	if n.CallerFile != file || n.CallerLine != line+1 {
+		t.Fatalf("expected the caller of NewNumericExperiment, got %s:%d", n.CallerFile, n.CallerLine)
+	}
+
+	f := func() interface{} { return 1 }
+	_, _, line, _ = runtime.Caller(0)
+	m := MustExperiment("test", WithControl(f), WithCandidate(f))
+	if m.CallerFile != file || m.CallerLine != line+1 {
+		t.Fatalf("expected the caller of MustExperiment, got %s:%d", m.CallerFile, m.CallerLine)
+	}
+}
+
+func TestExperimentComparatorTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	e := NewExperiment("test")
+	e.ComparatorTimeout = 5 * time.Millisecond
+	e.Control = func() interface{} { return 1 }
+	e.Candidate = func() interface{} { return 2 }
+	e.Comparator = func(a, b interface{}) bool {
+		<-release
+		return false
+	}
+
+	var result *Result
+	e.Publish = func(r *Result) { result = r }
+	e.Run()
+
+	if !result.ComparisonTimedOut || result.Compared {
+		t.Fatal("expected a slow comparator to time out without a comparison")
+	}
+	if e.Stats().Mismatches != 0 {
+		t.Fatal("expected a timed out comparison not to count as a mismatch")
+	}
+
+	e.Comparator = DeepEqual
+	e.Run()
+	if result.ComparisonTimedOut || !result.Compared || result.Matched {
+		t.Fatal("expected a fast comparator to be used within the timeout")
+	}
+}
+
+func TestExperimentComparatorPanicsPropagate(t *testing.T) {
+	for _, timeout := range []time.Duration{0, time.Second} {
+		e := NewExperiment("test")
+		e.ComparatorTimeout = timeout
+		e.Control = func() interface{} { return 1 }
+		e.Candidate = func() interface{} { return 2 }
+		e.Comparator = func(a, b interface{}) bool { panic("comparator bug") }
+		e.Publish = func(*Result) {}
+
+		func() {
+			defer func() {
+				if p := recover(); p != "comparator bug" {
+					t.Fatalf("expected the comparator panic to propagate with timeout %v, got %v", timeout, p)
+				}
+			}()
+			e.Run()
+		}()
+
+		var result *Result
+		e.Publish = func(r *Result) { result = r }
+		e.Comparator = JSONCanonicalComparator
+		e.Candidate = func() interface{} { return make(chan int) }
+		e.Run()
+		if result.ComparisonErr == nil {
+			t.Fatalf("expected a comparator failure to be recorded with timeout %v", timeout)
+		}
+	}
+}
+
+func TestExperimentResultFilter(t *testing.T) {
+	e := NewExperiment("test")
+	e.Control = func() interface{} { return 1 }
+	e.Candidate = func() interface{} { return 2 }
+	e.ResultFilter = func(r *Result) *Result {
+		if r.Matched {
+			return nil
+		}
+		r.Name = "filtered"
+		return r
+	}
+
+	var published []*Result
+	e.Publish = func(r *Result) { published = append(published, r) }
+	events := e.Events()
+
+	e.Run()
+	if len(published) != 1 || published[0].Name != "filtered" {
+		t.Fatal("expected the filtered result to be published")
+	}
+	if r := <-events; r.Name != "filtered" {
+		t.Fatal("expected the filtered result on the events channel")
+	}
+
+	e.Candidate = func() interface{} { return 1 }
+	e.Run()
+	if len(published) != 1 {
+		t.Fatal("expected a nil result from the filter to skip Publish")
+	}
+
+	logger := &testLogger{}
+	e.Logger = logger
+	e.ResultFilter = func(*Result) *Result { panic("boom") }
+	e.Run()
+	if len(published) != 1 || len(logger.Lines()) != 1 {
+		t.Fatal("expected a panic in the filter to be logged and the result dropped")
+	}
+}
+
+func TestExperimentErrorOnMismatch(t *testing.T) {
+	e := NewExperiment("test")
+	e.Control = func() interface{} { return 1 }
+	e.Candidate = func() interface{} { return 2 }
+
+	if err := e.Run(); err != nil {
+		t.Fatal("expected no error on mismatch by default")
+	}
+
+	e.ErrorOnMismatch = true
+	v, err := e.RunValue()
+	if !errors.Is(err, ErrMismatch) {
+		t.Fatalf("expected ErrMismatch, got %v", err)
+	}
+	if v != 1 {
+		t.Fatal("expected the control's value to still be returned")
+	}
+
+	var mismatch *MismatchError
+	if !errors.As(err, &mismatch) || mismatch.Result.Candidate.Value != 2 {
+		t.Fatal("expected the error to carry the result")
+	}
+	if err.Error() != `experiment "test": candidate did not match control` {
+		t.Fatalf("unexpected error message %q", err)
+	}
+
+	e.Candidate = func() interface{} { return 1 }
+	if err := e.Run(); err != nil {
+		t.Fatal("expected no error when the candidate matches")
+	}
+}
+
+func TestExperimentObservationWhich(t *testing.T) {
+	logger := &testLogger{}
+	e := NewExperiment("test")
+	e.Logger = logger
+	e.RecoverControl = true
+	e.Control = func() interface{} { return 1 }
+	e.Candidate = func() interface{} { panic("boom") }
+
+	var result *Result
+	e.Publish = func(r *Result) { result = r }
+	e.Run()
+
+	if result.Control.Which != "control" || result.Candidate.Which != "candidate" {
+		t.Fatalf("expected observations to name their branch, got %q and %q", result.Control.Which, result.Candidate.Which)
+	}
+
+	e.Control = func() interface{} { panic("bang") }
+	e.Candidate = func() interface{} { return 1 }
+	e.Run()
+
+	lines := logger.Lines()
+	if len(lines) != 2 ||
+		lines[0] != `science: experiment "test": candidate panicked: boom` ||
+		lines[1] != `science: experiment "test": control panicked: bang` {
+		t.Fatalf("expected the panics to be attributed to their branch, got %q", lines)
+	}
+}
+
+func TestExperimentDurationBudget(t *testing.T) {
+	e := NewExperiment("test")
+	e.DurationBudget = time.Minute
+	e.Control = func() interface{} { return 1 }
+	e.Candidate = func() interface{} { return 1 }
+
+	var result *Result
+	e.Publish = func(r *Result) { result = r }
+	e.Run()
+
+	if !result.CandidateWithinBudget {
+		t.Fatal("expected a fast candidate to be within budget")
+	}
+
+	e.DurationBudget = time.Millisecond
+	e.Candidate = func() interface{} {
+		time.Sleep(5 * time.Millisecond)
+		return 1
+	}
+	e.Run()
+
+	if result.CandidateWithinBudget {
+		t.Fatal("expected a slow candidate to be over budget")
+	}
+}
+
+func TestExperimentSetPublishAndEnabled(t *testing.T) {
+	e := NewExperiment("test")
+	e.Control = func() interface{} { return 1 }
+	e.Candidate = func() interface{} { return 1 }
+	e.Publish = func(*Result) { t.Fatal("expected the Publish field to be replaced") }
+
+	var mu sync.Mutex
+	published := 0
+	e.SetPublish(func(*Result) {
+		mu.Lock()
+		defer mu.Unlock()
+		published++
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e.Run()
+		}()
+	}
+	e.SetEnabled(func() bool { return true })
+	wg.Wait()
+
+	if published != 10 {
+		t.Fatalf("expected every run to be published, got %d", published)
+	}
+
+	e.SetEnabled(func() bool { return false })
+	e.Run()
+	if published != 10 || e.Stats().Skips != 1 {
+		t.Fatal("expected the replaced Enabled function to be used")
+	}
+
+	if c := e.Clone(); c.Enabled() {
+		t.Fatal("expected Clone to copy the replaced Enabled function")
+	}
+}
+
+func TestExperimentClean(t *testing.T) {
+	type event struct {
+		Name string
+		At   time.Time
+	}
+	clean := func(v interface{}) interface{} {
+		ev := v.(event)
+		ev.At = time.Time{}
+		return ev
+	}
+
+	e := NewExperiment("test")
+	e.Clean = clean
+	e.Control = func() interface{} { return event{"a", time.Unix(1, 0)} }
+	e.Candidate = func() interface{} { return event{"a", time.Unix(2, 0)} }
+
+	var result *Result
+	e.Publish = func(r *Result) { result = r }
+
+	v, _ := e.RunValue()
+	if !v.(event).At.Equal(time.Unix(1, 0)) {
+		t.Fatal("expected the raw value to be returned")
+	}
+	if result.Matched {
+		t.Fatal("expected the raw values to be compared by default")
+	}
+	if !result.Control.Value.(event).At.IsZero() {
+		t.Fatal("expected the published values to be cleaned")
+	}
+
+	e.CompareCleaned = true
+	e.Run()
+	if !result.Matched {
+		t.Fatal("expected the cleaned values to be compared with CompareCleaned")
+	}
+}
+
+func TestExperimentCleanCannotCrashTheCaller(t *testing.T) {
+	e := NewExperiment("test")
+	e.ExpectedType = reflect.TypeOf(0)
+	e.CompareCleaned = true
+	e.Clean = func(v interface{}) interface{} {
+		if v.(int) < 0 {
+			panic("negative")
+		}
+		return v.(int) * 2
+	}
+	e.Control = func() interface{} { return 1 }
+	e.Candidate = func() interface{} { return "1" }
+
+	var result *Result
+	e.Publish = func(r *Result) { result = r }
+
+	if v, err := e.RunValue(); err != nil || v != 1 {
+		t.Fatalf("expected the control's value, got %v, %v", v, err)
+	}
+	if !result.TypeMismatch || result.Candidate.Value != "1" || result.Control.Value != 2 {
+		t.Fatalf("expected Clean to be skipped for the mistyped candidate, got %+v", result)
+	}
+
+	e.Candidate = func() interface{} { return -1 }
+	if v, err := e.RunValue(); err != nil || v != 1 {
+		t.Fatalf("expected the control's value, got %v, %v", v, err)
+	}
+	if result.Compared || result.Candidate.Value != nil {
+		t.Fatal("expected a panic in Clean on the candidate's value to skip the comparison and publish no value")
+	}
+
+	e.Candidate = func() interface{} { panic("candidate broke") }
+	if v, err := e.RunValue(); err != nil || v != 1 {
+		t.Fatalf("expected the control's value, got %v, %v", v, err)
+	}
+}
+
+func TestExperimentInputCloner(t *testing.T) {
+	defer ClearDeterministicOrder()
+	SetDeterministicOrder(false)
+
+	e := NewExperiment("test")
+	e.ControlFn = func(in interface{}) interface{} { return in.([]int)[0] }
+	e.CandidateFn = func(in interface{}) interface{} {
+		s := in.([]int)
+		s[0]++
+		return s[0] - 1
+	}
+	e.InputCloner = func(in interface{}) interface{} {
+		return append([]int(nil), in.([]int)...)
+	}
+
+	var result *Result
+	e.Publish = func(r *Result) { result = r }
+
+	input := []int{1}
+	e.RunWith(input)
+
+	if input[0] != 1 {
+		t.Fatal("expected the candidate to be given a copy of the input")
+	}
+
+	if !result.Matched {
+		t.Fatal("expected the control to see the original input")
+	}
+
+	e.Enabled = func() bool { return false }
+	e.InputCloner = func(in interface{}) interface{} {
+		t.Fatal("expected the input not to be copied when the candidate does not run")
+		return in
+	}
+	e.RunWith(input)
+}
+
+func TestExperimentRecoversCandidatePanics(t *testing.T) {
+	e := NewExperiment("test")
+	e.Control = func() interface{} { return 42 }
+	e.Candidate = func() interface{} { panic("boom") }
+
+	var result *Result
+	e.Publish = func(r *Result) { result = r }
+
+	v, err := e.RunValue()
+	if err != nil || v.(int) != 42 {
+		t.Fatal("expected the control value to be returned")
+	}
+
+	if !result.Candidate.Panicked || result.Candidate.Panic != "boom" {
+		t.Fatal("expected the candidate panic to be recorded")
+	}
+
+	if result.Matched {
+		t.Fatal("expected a panicking candidate to mismatch")
+	}
+}
+
+func TestExperimentRunContextUsesContextEnabled(t *testing.T) {
+	type tenantKey struct{}
+
+	candidateRan := false
+	e := NewExperiment("test")
+	e.Control = func() interface{} { return nil }
+	e.Candidate = func() interface{} {
+		candidateRan = true
+		return nil
+	}
+	e.ContextEnabled = func(ctx context.Context) bool {
+		return ctx.Value(tenantKey{}) == "beta"
+	}
+
+	e.RunContext(context.WithValue(context.Background(), tenantKey{}, "prod"))
+	if candidateRan {
+		t.Fatal("expected ContextEnabled to disable the candidate")
+	}
+
+	e.RunContext(context.WithValue(context.Background(), tenantKey{}, "beta"))
+	if !candidateRan {
+		t.Fatal("expected ContextEnabled to enable the candidate")
+	}
+
+	candidateRan = false
+	e.Enabled = func() bool { return false }
+	e.Run()
+	if candidateRan {
+		t.Fatal("expected Run to use Enabled")
+	}
+}
+
+func TestExperimentRunContextUsesContextComparator(t *testing.T) {
+	type toleranceKey struct{}
+
+	e := NewExperiment("test")
+	e.Control = func() interface{} { return 1.0 }
+	e.Candidate = func() interface{} { return 1.05 }
+	e.ContextComparator = func(ctx context.Context, control, candidate interface{}) bool {
+		tolerance, _ := ctx.Value(toleranceKey{}).(float64)
+		return NumericComparator(tolerance)(control, candidate)
+	}
+
+	var result *Result
+	e.Publish = func(r *Result) { result = r }
+
+	e.RunContext(context.WithValue(context.Background(), toleranceKey{}, 0.1))
+	if !result.Matched {
+		t.Fatal("expected the context's tolerance to be used")
+	}
+
+	e.RunContext(context.WithValue(context.Background(), toleranceKey{}, 0.01))
+	if result.Matched {
+		t.Fatal("expected a stricter tolerance to mismatch")
+	}
+
+	e.Comparator = func(a, b interface{}) bool { return true }
+	e.Run()
+	if !result.Matched {
+		t.Fatal("expected Run to use Comparator")
+	}
+}
+
+func TestExperimentSkipsComparatorForSamePointer(t *testing.T) {
+	shared := &struct{ data []int }{}
+
+	e := NewExperiment("test")
+	e.Control = func() interface{} { return shared }
+	e.Candidate = func() interface{} { return shared }
+
+	compared := false
+	e.Comparator = func(a, b interface{}) bool {
+		compared = true
+		return false
+	}
+
+	var result *Result
+	e.Publish = func(r *Result) { result = r }
+	e.Run()
+
+	if compared || !result.Matched {
+		t.Fatal("expected identical pointers to match without the comparator")
+	}
+
+	e.Candidate = func() interface{} { return &struct{ data []int }{} }
+	e.Run()
+	if !compared {
+		t.Fatal("expected different pointers to use the comparator")
+	}
+
+	if samePointer((*int)(nil), (*int)(nil)) {
+		t.Fatal("expected nil pointers not to take the fast path")
+	}
+
+	e.Comparator = nil
+	e.Candidate = func() interface{} { return nil }
+	e.Run()
+	if !result.Compared || result.Matched {
+		t.Fatal("expected a nil candidate to be compared with the control's pointer and mismatch")
+	}
+}
+
+func TestExperimentPause(t *testing.T) {
+	candidateRan := false
+	e := NewExperiment("test")
+	e.Control = func() interface{} { return nil }
+	e.Candidate = func() interface{} {
+		candidateRan = true
+		return nil
+	}
+
+	e.Pause()
+	e.Run()
+	if candidateRan || !e.Paused() {
+		t.Fatal("expected a paused experiment to run only the control")
+	}
+
+	e.Resume()
+	e.Run()
+	if !candidateRan {
+		t.Fatal("expected a resumed experiment to run the candidate")
+	}
+}
+
+func TestExperimentAlwaysPublishReturnsRawValue(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		setup func(*Experiment)
+	}{
+		{"discarded", func(e *Experiment) { e.DiscardValues = true }},
+		{"redacted", func(e *Experiment) { e.Redact = true }},
+		{"cleaned", func(e *Experiment) { e.Clean = func(interface{}) interface{} { return 0 } }},
+	} {
+		for _, skip := range []func(*Experiment){
+			func(e *Experiment) { e.Enabled = func() bool { return false } },
+			func(e *Experiment) { e.BaselineOnly = true },
+		} {
+			e := NewExperiment("test")
+			e.AlwaysPublish = true
+			e.Control = func() interface{} { return 1 }
+			e.Candidate = func() interface{} { return 1 }
+			var result *Result
+			e.Publish = func(r *Result) { result = r }
+			tc.setup(e)
+			skip(e)
+
+			if v, _ := e.RunValue(); v != 1 {
+				t.Fatalf("%s: expected the control's value to be returned, got %v", tc.name, v)
+			}
+			if result == nil || result.Control.Value == 1 {
+				t.Fatalf("%s: expected the published value to be prepared", tc.name)
+			}
+		}
+	}
+}
+
+func TestExperimentAlwaysPublish(t *testing.T) {
+	e := NewExperiment("test")
+	e.AlwaysPublish = true
+	e.Enabled = func() bool { return false }
+	e.Control = func() interface{} { return 42 }
+	e.Candidate = func() interface{} {
+		t.Fatal("expected the candidate not to run")
+		return nil
+	}
+
+	var result *Result
+	e.Publish = func(r *Result) { result = r }
+
+	v, err := e.RunValue()
+	if err != nil || v.(int) != 42 {
+		t.Fatal("expected the control value to be returned")
+	}
+
+	if result == nil || result.Candidate != nil || result.Control.Value.(int) != 42 {
+		t.Fatal("expected a result with only the control observation")
+	}
+
+	if result.SkipReason != SkipNotEnabled {
+		t.Fatalf("expected skip reason %q, got %q", SkipNotEnabled, result.SkipReason)
+	}
+
+	e.Pause()
+	e.Run()
+	if result.SkipReason != SkipPaused {
+		t.Fatalf("expected skip reason %q, got %q", SkipPaused, result.SkipReason)
+	}
+}
+
+func TestExperimentSetup(t *testing.T) {
+	setups := 0
+	e := NewExperiment("test")
+	e.Setup = func() interface{} {
+		setups++
+		return []int{1, 2, 3}
+	}
+	e.ControlFn = func(in interface{}) interface{} { return len(in.([]int)) }
+	e.CandidateFn = func(in interface{}) interface{} { return len(in.([]int)) }
+
+	var result *Result
+	e.Publish = func(r *Result) { result = r }
+
+	v, err := e.RunValue()
+	if err != nil || v.(int) != 3 {
+		t.Fatalf("expected the control to be given the setup value, got %v %v", v, err)
+	}
+
+	if setups != 1 {
+		t.Fatalf("expected setup to run once, ran %d times", setups)
+	}
+
+	if !result.Matched || len(result.Input.([]int)) != 3 {
+		t.Fatal("expected both branches to be given the setup value")
+	}
+
+	if e.RunControlOnly().(int) != 3 || setups != 2 {
+		t.Fatal("expected RunControlOnly to use the setup value")
+	}
+}
+
+func TestExperimentRunAgainstGolden(t *testing.T) {
+	e := NewExperiment("test")
+	e.Enabled = func() bool { return false }
+	e.Golden = []string{"a", "b"}
+	e.Candidate = func() interface{} { return []string{"a", "b"} }
+
+	result, err := e.RunAgainstGolden()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !result.Matched || result.Control.Duration != 0 {
+		t.Fatal("expected the candidate to match the golden value")
+	}
+
+	e.Candidate = func() interface{} { return []string{"b", "a"} }
+	result, _ = e.RunAgainstGolden()
+	if result.Matched {
+		t.Fatal("expected a different candidate value to mismatch")
+	}
+}
+
+func TestExperimentSkipCompareIf(t *testing.T) {
+	e := NewExperiment("test")
+	e.Control = func() interface{} { return -1 }
+	e.Candidate = func() interface{} { return -2 }
+	e.SkipCompareIf = func(control, candidate interface{}) bool {
+		return control.(int) < 0
+	}
+	e.OnMismatch = func(*Result) { t.Fatal("expected skipped comparisons not to be mismatches") }
+
+	var result *Result
+	e.Publish = func(r *Result) { result = r }
+	e.Run()
+
+	if result.Compared || result.Matched {
+		t.Fatal("expected the result not to be compared")
+	}
+
+	if s := e.Stats(); s.Matches != 0 || s.Mismatches != 0 {
+		t.Fatalf("expected skipped comparisons to be left out of the tallies, got %+v", s)
+	}
+
+	e.Candidate = func() interface{} { return -1 }
+	e.SkipCompareIf = nil
+	e.Run()
+	if !result.Compared || !result.Matched {
+		t.Fatal("expected the result to be compared")
+	}
+}
+
+func TestExperimentMeasureCPU(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("CPU time is only measured on Linux")
+	}
+
+	burn := func() interface{} {
+		n := 0
+		for start := time.Now(); time.Since(start) < 20*time.Millisecond; n++ {
+		}
+		return nil
+	}
+
+	e := NewExperiment("test")
+	e.MeasureCPU = true
+	e.Control = burn
+	e.Candidate = func() interface{} {
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	}
+
+	var result *Result
+	e.Publish = func(r *Result) { result = r }
+	e.Run()
+
+	if result.Control.CPUTime <= 0 {
+		t.Fatal("expected the control's CPU time to be measured")
+	}
+
+	if result.Candidate.CPUTime >= result.Control.CPUTime {
+		t.Fatalf("expected sleeping to use less CPU than spinning, got %v and %v",
+			result.Candidate.CPUTime, result.Control.CPUTime)
+	}
+}
+
+func TestExperimentExpectedType(t *testing.T) {
+	e := NewExperiment("test")
+	e.ExpectedType = reflect.TypeOf(0)
+	e.Control = func() interface{} { return 1 }
+	e.Candidate = func() interface{} { return int64(1) }
+	e.Comparator = func(a, b interface{}) bool {
+		return a.(int) == b.(int)
+	}
+
+	var result *Result
+	e.Publish = func(r *Result) { result = r }
+	e.Run()
+
+	if !result.TypeMismatch || result.Matched || !result.Compared {
+		t.Fatal("expected a value of the wrong type to be a type mismatch")
+	}
+
+	e.Candidate = func() interface{} { return 1 }
+	e.Run()
+	if result.TypeMismatch || !result.Matched {
+		t.Fatal("expected values of the expected type to be compared")
+	}
+
+	e.ExpectedType = reflect.TypeOf((*error)(nil)).Elem()
+	e.Comparator = ErrorComparator
+	e.Control = func() interface{} { return nil }
+	e.Candidate = func() interface{} { return errors.New("x") }
+	e.Run()
+	if result.TypeMismatch {
+		t.Fatal("expected nil and errors to satisfy an error type")
+	}
+}
+
+func TestExperimentBaselineOnly(t *testing.T) {
+	e := NewExperiment("test")
+	e.BaselineOnly = true
+	e.Control = func() interface{} { return 42 }
+
+	var result *Result
+	e.Publish = func(r *Result) { result = r }
+
+	v, err := e.RunValue()
+	if err != nil || v.(int) != 42 {
+		t.Fatalf("expected the control value without a candidate, got %v, %v", v, err)
+	}
+
+	if result == nil || result.Candidate != nil || result.Control.Value.(int) != 42 {
+		t.Fatal("expected a result with only the control observation")
+	}
+	if result.SkipReason != SkipBaseline || result.Compared {
+		t.Fatalf("expected skip reason %q, got %q", SkipBaseline, result.SkipReason)
+	}
+
+	if s := e.Stats(); s.Runs != 1 || s.Skips != 1 {
+		t.Fatalf("expected one skipped run, got %+v", s)
+	}
+
+	result = nil
+	e.Enabled = func() bool { return false }
+	if v, _ := e.RunValue(); v != 42 || result != nil {
+		t.Fatal("expected a disabled baseline run not to be published")
+	}
+	e.AlwaysPublish = true
+	if e.Run(); result == nil || result.SkipReason != SkipNotEnabled {
+		t.Fatalf("expected a disabled baseline run to be published with AlwaysPublish, got %+v", result)
+	}
+	e.Enabled = nil
+	e.AlwaysPublish = false
+
+	e.BaselineOnly = false
+	if err := e.Run(); err != ErrNoCandidate {
+		t.Fatalf("expected ErrNoCandidate once the baseline is over, got %v", err)
+	}
+}
+
+func TestExperimentRunWithConcurrently(t *testing.T) {
+	type request struct{ ID int }
+
+	e := NewExperiment("test")
+	e.HashValues = true
+	e.InputCloner = func(in interface{}) interface{} { r := *in.(*request); return &r }
+	e.ControlFn = func(in interface{}) interface{} { return in.(*request).ID }
+	e.CandidateFn = func(in interface{}) interface{} {
+		if id := in.(*request).ID; id%3 != 0 {
+			return id
+		}
+		return -1
+	}
+
+	var mu sync.Mutex
+	results := make(map[int]*Result)
+	e.Publish = func(r *Result) {
+		mu.Lock()
+		defer mu.Unlock()
+		results[r.Input.(*request).ID] = r
+	}
+
+	const n = 1000
+	var wg sync.WaitGroup
+	for g := 0; g < 10; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for id := g; id < n; id += 10 {
+				v, err := e.RunWith(&request{ID: id})
+				if err != nil || v.(int) != id {
+					t.Errorf("expected %d to be returned, got %v, %v", id, v, err)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	if len(results) != n {
+		t.Fatalf("expected %d results, got %d", n, len(results))
+	}
+	for id, r := range results {
+		if r.Control.Value.(int) != id || r.Control.Hash != hashValue(id) {
+			t.Fatalf("expected result %d to have its own control value, got %v", id, r.Control.Value)
+		}
+		if r.Matched != (id%3 != 0) {
+			t.Fatalf("expected result %d to reflect its own comparison", id)
+		}
+	}
+
+	if s := e.Stats(); s.Runs != n || s.Mismatches != (n+2)/3 {
+		t.Fatalf("expected every run to be counted, got %+v", s)
+	}
+}
+
+func TestOnRun(t *testing.T) {
+	defer func(f func(*Result)) { OnRun = f }(OnRun)
+
+	var results []*Result
+	OnRun = func(r *Result) {
+		if r.Name == "onrun" {
+			results = append(results, r)
+		}
+	}
+
+	logger := &testLogger{}
+	e := NewExperiment("onrun")
+	e.Logger = logger
+	e.Control = func() interface{} { return 1 }
+	e.Candidate = func() interface{} { return 1 }
+	e.Publish = nil
+	e.Run()
+
+	e.Candidate = func() interface{} { return 2 }
+	e.Publish = func(*Result) {}
+	e.Run()
+
+	e.AlwaysPublish = true
+	e.Enabled = func() bool { return false }
+	e.Run()
+
+	if len(results) != 3 || !results[0].Matched || results[1].Matched || results[2].SkipReason != SkipNotEnabled {
+		t.Fatalf("expected OnRun to see matched, mismatched, and disabled runs, got %v", results)
+	}
+
+	OnRun = func(*Result) { panic("boom") }
+	var published bool
+	e.Publish = func(*Result) { published = true }
+	if v, err := e.RunValue(); err != nil || v.(int) != 1 || !published {
+		t.Fatal("expected a panic in OnRun not to affect the run")
+	}
+	if lines := logger.Lines(); len(lines) != 1 || !strings.Contains(lines[0], "OnRun panicked: boom") {
+		t.Fatalf("expected the panic to be logged, got %q", lines)
+	}
+}
+
+func TestExperimentScore(t *testing.T) {
+	closeness := func(a, b interface{}) float64 {
+		return 1 - math.Abs(a.(float64)-b.(float64))
+	}
+
+	e := NewExperiment("test")
+	e.Score = closeness
+	e.ScoreThreshold = 0.9
+	e.Comparator = func(a, b interface{}) bool { panic("expected Score to be used in place of Comparator") }
+	e.Control = func() interface{} { return 0.5 }
+	e.Candidate = func() interface{} { return 0.25 }
+
+	var result *Result
+	e.Publish = func(r *Result) { result = r }
+
+	e.Run()
+	if result.Score != 0.75 || result.Matched {
+		t.Fatalf("expected a mismatch with a score of 0.75, got %v %v", result.Matched, result.Score)
+	}
+
+	e.Candidate = func() interface{} { return 0.5 }
+	e.Run()
+	if result.Score != 1 || !result.Matched {
+		t.Fatalf("expected a match with a score of 1, got %v %v", result.Matched, result.Score)
+	}
+
+	calls := 0
+	e.Score = func(a, b interface{}) float64 {
+		calls++
+		return closeness(a, b)
+	}
+	e.ComparatorTimeout = time.Second
+	e.Run()
+	if calls != 1 || result.Score != 1 {
+		t.Fatalf("expected Score to be called once within the timeout, got %d calls", calls)
+	}
+
+	shared := &struct{}{}
+	e.Control = func() interface{} { return shared }
+	e.Candidate = func() interface{} { return shared }
+	e.Run()
+	if calls != 1 || result.Score != 1 || !result.Matched {
+		t.Fatal("expected the same pointer to match with a score of 1")
+	}
+
+	e.Control = func() interface{} { return 0.5 }
+	e.Candidate = func() interface{} { return 0.5 }
+	e.Score = func(a, b interface{}) float64 { panic("boom") }
+	func() {
+		defer func() {
+			if p := recover(); p != "boom" {
+				t.Fatalf("expected a panic in Score to propagate, got %v", p)
+			}
+		}()
+		e.Run()
+	}()
+}
+
+func TestExperimentSkipPublishOnMatchedError(t *testing.T) {
+	outage := errors.New("upstream unavailable")
+
+	e := NewExperiment("test")
+	e.SkipPublishOnMatchedError = true
+	e.Comparator = ValuesComparator
+	e.Control = func() interface{} { return Values(0, outage) }
+	e.Candidate = func() interface{} { return Values(0, outage) }
+
+	published := 0
+	e.Publish = func(*Result) { published++ }
+
+	e.Run()
+	if published != 0 {
+		t.Fatal("expected matching results with equal errors not to be published")
+	}
+	if s := e.Stats(); s.Runs != 1 || s.Matches != 1 {
+		t.Fatalf("expected the run to still be counted, got %+v", s)
+	}
+
+	e.Candidate = func() interface{} { return Values(0, errors.New("timeout")) }
+	e.Run()
+	if published != 1 {
+		t.Fatal("expected different errors to be published")
+	}
+
+	e.Candidate = func() interface{} { return Values(1, fmt.Errorf("fetch: %w", outage)) }
+	e.Run()
+	if published != 2 {
+		t.Fatal("expected different values with equal errors to be published")
+	}
+
+	e.Comparator = ErrorComparator
+	e.Control = func() interface{} { return outage }
+	e.Candidate = func() interface{} { return fmt.Errorf("fetch: %w", outage) }
+	e.Run()
+	if published != 2 {
+		t.Fatal("expected matching error values not to be published")
+	}
+
+	e.Control = func() interface{} { return Values(1, nil) }
+	e.Candidate = func() interface{} { return Values(1, nil) }
+	e.Run()
+	if published != 3 {
+		t.Fatal("expected results without errors to be published")
+	}
+}
+
+func TestExperimentRunContextCancelsComparison(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+
+	e := NewExperiment("test")
+	e.Logger = &testLogger{}
+	e.Control = func() interface{} { return 1 }
+	e.Candidate = func() interface{} { return 1 }
+	e.Comparator = func(a, b interface{}) bool {
+		close(started)
+		<-release
+		return true
+	}
+
+	var result *Result
+	e.Publish = func(r *Result) { result = r }
+
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	done := make(chan error)
+	go func() { done <- e.RunContext(ctx) }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected RunContext to return once its context was cancelled")
+	}
+
+	if !result.ComparisonCancelled || result.Compared || result.Matched {
+		t.Fatalf("expected the comparison to be abandoned, got %+v", result)
+	}
+
+	e.Comparator = func(a, b interface{}) bool {
+		t.Fatal("expected the comparator not to be called with a cancelled context")
+		return false
+	}
+	e.RunContext(ctx)
+	if !result.ComparisonCancelled {
+		t.Fatal("expected a context cancelled before the comparison to abandon it")
+	}
+}
@@ -0,0 +1,86 @@
+// Package sciencetest provides helpers for checking science experiments in
+// tests, such as in CI before a candidate is deployed.
+package sciencetest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/rubyist/science"
+)
+
+// AssertStable runs the experiment tries times and fails the test only if
+// the candidate mismatched the control on every try, which points to a
+// deterministic divergence, such as a genuine bug in a refactor. If it
+// mismatched on some tries but not others, the difference is nondeterministic,
+// such as unstable ordering, and AssertStable logs how often it happened
+// without failing the test. A candidate panic counts as a mismatch, and
+// tries in which the values were not compared, for example because of
+// SkipCompareIf, are left out.
+//
+// The experiment is not modified: it is run through a Clone whose candidate
+// always runs and whose results are collected synchronously, instead of being
+// published, filtered, or sampled. Any other configuration, such as the
+// Comparator or Setup, applies as usual. If tries is less than one, the
+// experiment is run once.
+//
+//	func TestParse(t *testing.T) {
+//		sciencetest.AssertStable(t, parseExperiment(), 10)
+//	}
+func AssertStable(t testing.TB, e *science.Experiment, tries int) {
+	t.Helper()
+
+	if tries < 1 {
+		tries = 1
+	}
+
+	var result *science.Result
+	c := e.Clone()
+	c.Enabled = func() bool { return true }
+	c.SampleKey = nil
+	c.Publish = func(r *science.Result) { result = r }
+	c.Async = false
+	c.Shadow = false
+	c.ResultFilter = nil
+	c.StreamPublish = nil
+	c.BaselineOnly = false
+	c.BreakerThreshold = 0
+	c.Warmup = 0
+	c.ErrorOnMismatch = false
+
+	var compared, mismatches int
+	var last *science.Result
+	for i := 0; i < tries; i++ {
+		result = nil
+		if err := c.Run(); err != nil {
+			t.Fatalf("experiment %q: %v", e.Name, err)
+		}
+		if result == nil || !result.Compared {
+			continue
+		}
+		compared++
+		if !result.Matched {
+			mismatches++
+			last = result
+		}
+	}
+
+	switch {
+	case compared == 0:
+		t.Fatalf("experiment %q: the values were not compared on any of %d tries", e.Name, tries)
+	case mismatches == compared:
+		t.Errorf("experiment %q: candidate mismatched the control on all %d tries: control %v, candidate %v",
+			e.Name, compared, describe(last.Control), describe(last.Candidate))
+	case mismatches > 0:
+		t.Logf("experiment %q: candidate mismatched the control on %d of %d tries, so the difference is nondeterministic: control %v, candidate %v",
+			e.Name, mismatches, compared, describe(last.Control), describe(last.Candidate))
+	}
+}
+
+// describe returns the observation's value, or what it panicked with.
+func describe(o *science.Observation) interface{} {
+	if o.Panicked {
+		return fmt.Sprintf("panic(%v)", o.Panic)
+	}
+	return o.Value
+}
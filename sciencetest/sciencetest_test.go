@@ -0,0 +1,88 @@
+package sciencetest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/rubyist/science"
+)
+
+// recorder is a testing.TB that records failures instead of reporting them.
+type recorder struct {
+	testing.TB
+	errors []string
+	logs   []string
+	fatal  bool
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Logf(format string, args ...interface{}) {
+	r.logs = append(r.logs, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Fatalf(format string, args ...interface{}) {
+	r.Errorf(format, args...)
+	r.fatal = true
+}
+
+func experiment(candidate science.ExperimentFunc) *science.Experiment {
+	e := science.NewExperiment("test")
+	e.Control = func() interface{} { return 1 }
+	e.Candidate = candidate
+	return e
+}
+
+func TestAssertStable(t *testing.T) {
+	r := &recorder{}
+	AssertStable(r, experiment(func() interface{} { return 1 }), 5)
+	if len(r.errors) != 0 || len(r.logs) != 0 {
+		t.Fatalf("expected a matching experiment to pass quietly, got %v %v", r.errors, r.logs)
+	}
+
+	r = &recorder{}
+	AssertStable(r, experiment(func() interface{} { return 2 }), 5)
+	if len(r.errors) != 1 || r.fatal {
+		t.Fatalf("expected a consistent mismatch to fail the test, got %v", r.errors)
+	}
+
+	tries := 0
+	r = &recorder{}
+	AssertStable(r, experiment(func() interface{} {
+		tries++
+		return tries % 2
+	}), 6)
+	if len(r.errors) != 0 || len(r.logs) != 1 {
+		t.Fatalf("expected an intermittent mismatch to be logged without failing, got %v %v", r.errors, r.logs)
+	}
+	if tries != 6 {
+		t.Fatalf("expected 6 tries, got %d", tries)
+	}
+}
+
+func TestAssertStableDoesNotModifyExperiment(t *testing.T) {
+	published := false
+	e := experiment(func() interface{} { return 2 })
+	e.Enabled = func() bool { return false }
+	e.Publish = func(*science.Result) { published = true }
+
+	r := &recorder{}
+	AssertStable(r, e, 3)
+	if len(r.errors) != 1 {
+		t.Fatalf("expected the candidate to run although the experiment is disabled, got %v", r.errors)
+	}
+	if published || e.Stats().Runs != 0 || e.Enabled() {
+		t.Fatal("expected the experiment itself not to be run or changed")
+	}
+
+	r = &recorder{}
+	e.SkipCompareIf = func(a, b interface{}) bool { return true }
+	AssertStable(r, e, 3)
+	if !r.fatal {
+		t.Fatal("expected an experiment that is never compared to fail the test")
+	}
+}
@@ -0,0 +1,86 @@
+package science
+
+import (
+	"context"
+	"sync"
+)
+
+// background tracks work running off the request path, so that Shutdown can
+// wait for it.
+var background struct {
+	sync.Mutex
+	wg       sync.WaitGroup
+	stopped  bool
+	buffered map[*BufferedPublisher]struct{}
+}
+
+// goBackground runs f on a new goroutine that Shutdown will wait for. It
+// returns false without running f if Shutdown has been called.
+func goBackground(f func()) bool {
+	background.Lock()
+	defer background.Unlock()
+
+	if background.stopped {
+		return false
+	}
+
+	background.wg.Add(1)
+	go func() {
+		defer background.wg.Done()
+		f()
+	}()
+	return true
+}
+
+func registerBuffered(p *BufferedPublisher) {
+	background.Lock()
+	defer background.Unlock()
+
+	if background.buffered == nil {
+		background.buffered = make(map[*BufferedPublisher]struct{})
+	}
+	background.buffered[p] = struct{}{}
+}
+
+func unregisterBuffered(p *BufferedPublisher) {
+	background.Lock()
+	defer background.Unlock()
+	delete(background.buffered, p)
+}
+
+// Shutdown stops experiments from starting new background work and waits for
+// work already started, such as Async publishes, to finish. Any open
+// BufferedPublishers are then closed, flushing their results. It should be
+// called as the process shuts down. Experiments that run after Shutdown
+// publish synchronously.
+//
+// If ctx is done before everything has finished, Shutdown returns its error.
+func Shutdown(ctx context.Context) error {
+	background.Lock()
+	background.stopped = true
+	background.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		background.wg.Wait()
+
+		background.Lock()
+		buffered := make([]*BufferedPublisher, 0, len(background.buffered))
+		for p := range background.buffered {
+			buffered = append(buffered, p)
+		}
+		background.Unlock()
+
+		for _, p := range buffered {
+			p.Close()
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
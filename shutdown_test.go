@@ -0,0 +1,85 @@
+package science
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// restartBackground undoes Shutdown so later tests can publish asynchronously.
+func restartBackground() {
+	background.Lock()
+	defer background.Unlock()
+	background.stopped = false
+}
+
+func TestShutdownDrainsAsyncPublishes(t *testing.T) {
+	defer restartBackground()
+
+	b := &batches{}
+	buffered := NewBufferedPublisher(b.publish, 100, 0)
+
+	var mu sync.Mutex
+	published := 0
+
+	e := NewExperiment("test")
+	e.Async = true
+	e.Control = func() interface{} { return 1 }
+	e.Candidate = func() interface{} { return 1 }
+	e.Publish = func(r *Result) {
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		published++
+		mu.Unlock()
+		buffered.Publish(r)
+	}
+
+	for i := 0; i < 3; i++ {
+		e.Run()
+	}
+
+	if err := Shutdown(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if published != 3 {
+		t.Fatalf("expected Shutdown to wait for all publishes, got %d", published)
+	}
+
+	if sizes := b.sizes(); len(sizes) != 1 || sizes[0] != 3 {
+		t.Fatalf("expected Shutdown to flush the buffered publisher, got %v", sizes)
+	}
+
+	e.Publish = func(*Result) { published++ }
+	e.Run()
+	if published != 4 {
+		t.Fatal("expected publishing to be synchronous after Shutdown")
+	}
+}
+
+func TestShutdownHonorsContext(t *testing.T) {
+	defer restartBackground()
+
+	block := make(chan struct{})
+	defer func() {
+		close(block)
+		Shutdown(context.Background())
+	}()
+
+	e := NewExperiment("test")
+	e.Async = true
+	e.Control = func() interface{} { return 1 }
+	e.Candidate = func() interface{} { return 1 }
+	e.Publish = func(*Result) { <-block }
+	e.Run()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected the deadline to be exceeded, got %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package science
+
+import (
+	"sync/atomic"
+)
+
+// Stats is a snapshot of an experiment's lifetime counters.
+type Stats struct {
+	Runs       int64 // Runs of the experiment, whether or not the candidate ran
+	Matches    int64 // Runs in which the candidate matched the control
+	Mismatches int64 // Runs in which the candidate did not match, including panics
+	Panics     int64 // Runs in which the candidate panicked
+	Skips      int64 // Runs in which only the control ran
+	Dropped    int64 // Results dropped because the Events channel was full
+}
+
+// counters holds the live values behind Stats.
+type counters struct {
+	runs       atomic.Int64
+	matches    atomic.Int64
+	mismatches atomic.Int64
+	panics     atomic.Int64
+	skips      atomic.Int64
+	dropped    atomic.Int64
+}
+
+// Stats returns a snapshot of the experiment's counters. Each counter is read
+// atomically, but they are not read together, so a snapshot taken while the
+// experiment is running may be slightly inconsistent.
+func (e *Experiment) Stats() Stats {
+	return Stats{
+		Runs:       e.counters.runs.Load(),
+		Matches:    e.counters.matches.Load(),
+		Mismatches: e.counters.mismatches.Load(),
+		Panics:     e.counters.panics.Load(),
+		Skips:      e.counters.skips.Load(),
+		Dropped:    e.counters.dropped.Load(),
+	}
+}
+
+// Reset clears the experiment's counters, percentile windows, and breaker.
+// Runs counted towards Warmup are not reset.
+func (e *Experiment) Reset() {
+	e.counters.runs.Store(0)
+	e.counters.matches.Store(0)
+	e.counters.mismatches.Store(0)
+	e.counters.panics.Store(0)
+	e.counters.skips.Store(0)
+	e.counters.dropped.Store(0)
+
+	e.durations.reset()
+	e.ResetBreaker()
+}
+
+func (e *Experiment) count(matched, panicked bool) {
+	if matched {
+		e.counters.matches.Add(1)
+	} else {
+		e.counters.mismatches.Add(1)
+	}
+	if panicked {
+		e.counters.panics.Add(1)
+	}
+}
@@ -0,0 +1,44 @@
+package science
+
+import (
+	"testing"
+)
+
+func TestExperimentStats(t *testing.T) {
+	values := []interface{}{1, 2, "panic", 1}
+	enabled := true
+
+	e := NewExperiment("test")
+	e.Enabled = func() bool { return enabled }
+	e.Control = func() interface{} { return 1 }
+
+	var i int
+	e.Candidate = func() interface{} {
+		v := values[i]
+		i++
+		if v == "panic" {
+			panic(v)
+		}
+		return v
+	}
+
+	for range values {
+		e.Run()
+	}
+	enabled = false
+	e.Run()
+
+	want := Stats{Runs: 5, Matches: 2, Mismatches: 2, Panics: 1, Skips: 1}
+	if got := e.Stats(); got != want {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+
+	e.Reset()
+	if got := e.Stats(); got != (Stats{}) {
+		t.Fatalf("expected Reset to clear the counters, got %+v", got)
+	}
+
+	if control, _ := e.Percentiles(); control.Count != 0 {
+		t.Fatal("expected Reset to clear the percentile windows")
+	}
+}
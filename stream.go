@@ -0,0 +1,138 @@
+package science
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultStreamInterval is how often partial results are sent to
+// StreamPublish when an experiment's StreamInterval is zero.
+const DefaultStreamInterval = time.Second
+
+// stream periodically sends partial results to StreamPublish while an
+// experiment's branches are running.
+type stream struct {
+	e            *Experiment
+	id           string
+	timestamp    time.Time
+	controlFirst bool
+
+	mu        sync.Mutex
+	control   progress
+	candidate progress
+
+	quit chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// progress records how far one branch has got.
+type progress struct {
+	start    time.Time
+	end      time.Time
+	value    interface{}
+	finished bool
+}
+
+func (e *Experiment) streamInterval() time.Duration {
+	if e.StreamInterval <= 0 {
+		return DefaultStreamInterval
+	}
+	return e.StreamInterval
+}
+
+func (e *Experiment) startStream(id string, ts time.Time) *stream {
+	interval := e.streamInterval()
+
+	s := &stream{
+		e:            e,
+		id:           id,
+		timestamp:    ts,
+		controlFirst: e.controlRunsFirst(),
+		quit:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+
+	go func() {
+		defer close(s.done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.quit:
+				return
+			case <-ticker.C:
+				s.publish()
+			}
+		}
+	}()
+
+	return s
+}
+
+// track wraps f so that its progress is recorded in p.
+func (s *stream) track(f ExperimentFunc, p *progress) ExperimentFunc {
+	return func() interface{} {
+		s.mu.Lock()
+		p.start = time.Now()
+		s.mu.Unlock()
+
+		v := f()
+
+		s.mu.Lock()
+		p.end = time.Now()
+		p.value = v
+		p.finished = true
+		s.mu.Unlock()
+
+		return v
+	}
+}
+
+// stop stops sending partial results, waiting for any in progress. It may
+// be called more than once.
+func (s *stream) stop() {
+	s.once.Do(func() {
+		close(s.quit)
+		<-s.done
+	})
+}
+
+func (s *stream) publish() {
+	defer func() {
+		if p := recover(); p != nil {
+			s.e.logf("science: experiment %q: stream publish panicked: %v", s.e.Name, p)
+		}
+	}()
+	s.e.StreamPublish(s.partial())
+}
+
+// partial returns a result describing the branches so far. A branch that has
+// not started has a nil Observation, and one that is still running has its
+// elapsed time as its Duration, no End, and no Value.
+func (s *stream) partial() *Result {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return &Result{
+		ID:           s.id,
+		Name:         s.e.Name,
+		Timestamp:    s.timestamp,
+		ControlFirst: s.controlFirst,
+		Control:      s.control.observation("control"),
+		Candidate:    s.candidate.observation("candidate"),
+		Partial:      true,
+	}
+}
+
+func (p *progress) observation(which string) *Observation {
+	switch {
+	case p.start.IsZero():
+		return nil
+	case p.finished:
+		return &Observation{Which: which, Duration: p.end.Sub(p.start), Start: p.start, End: p.end, Value: p.value}
+	}
+	return &Observation{Which: which, Duration: time.Since(p.start), Start: p.start}
+}
@@ -0,0 +1,66 @@
+package science
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestExperimentStreamPublish(t *testing.T) {
+	defer ClearDeterministicOrder()
+	SetDeterministicOrder(true)
+
+	e := NewExperiment("test")
+	e.StreamInterval = 5 * time.Millisecond
+	e.Control = func() interface{} {
+		time.Sleep(30 * time.Millisecond)
+		return 1
+	}
+	e.Candidate = func() interface{} {
+		time.Sleep(30 * time.Millisecond)
+		return 1
+	}
+
+	var mu sync.Mutex
+	var partials []*Result
+	e.StreamPublish = func(r *Result) {
+		mu.Lock()
+		defer mu.Unlock()
+		partials = append(partials, r)
+	}
+
+	var final *Result
+	e.Publish = func(r *Result) { final = r }
+	e.Run()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(partials) == 0 {
+		t.Fatal("expected partial results to be published")
+	}
+
+	for _, p := range partials {
+		if !p.Partial || p.Control == nil {
+			t.Fatal("expected partial results to show the control in progress")
+		}
+		if p.ID != final.ID {
+			t.Fatal("expected partial results to share the final result's ID")
+		}
+	}
+
+	last := partials[len(partials)-1]
+	if last.Control.Value != 1 || last.Candidate == nil {
+		t.Fatal("expected later partial results to show the candidate in progress")
+	}
+
+	if final.Partial {
+		t.Fatal("expected the final result not to be partial")
+	}
+
+	n := len(partials)
+	time.Sleep(20 * time.Millisecond)
+	if len(partials) != n {
+		t.Fatal("expected partial results to stop once the branches finish")
+	}
+}
@@ -0,0 +1,35 @@
+package science
+
+// Template is a shared configuration from which experiments are created, for
+// teams that give all their experiments the same comparator, publisher,
+// flags, and so on.
+type Template struct {
+	base *Experiment
+}
+
+// NewTemplate returns a Template configured by opts, starting from the same
+// defaults as NewExperiment. As an Option is any func(*Experiment), settings
+// without a With function can be given directly:
+//
+//	t := science.NewTemplate(
+//		science.WithPublish(publish),
+//		func(e *science.Experiment) { e.Comparator = science.NumericComparator(1e-9) },
+//	)
+func NewTemplate(opts ...Option) *Template {
+	return &Template{base: NewExperiment("", opts...)}
+}
+
+// New creates an experiment named name with the given control and candidate
+// and a copy of the template's configuration. Any opts are applied on top,
+// so individual experiments can override the template.
+func (t *Template) New(name string, control, candidate ExperimentFunc, opts ...Option) *Experiment {
+	e := t.base.Clone()
+	e.Name = name
+	e.Control = control
+	e.Candidate = candidate
+	e.captureCaller(1)
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
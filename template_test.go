@@ -0,0 +1,33 @@
+package science
+
+import "testing"
+
+func TestTemplate(t *testing.T) {
+	var published []*Result
+	tmpl := NewTemplate(
+		WithPublish(func(r *Result) { published = append(published, r) }),
+		func(e *Experiment) { e.Comparator = NumericComparator(0.1) },
+	)
+
+	a := tmpl.New("a", func() interface{} { return 1.0 }, func() interface{} { return 1.05 })
+	b := tmpl.New("b", func() interface{} { return 1 }, func() interface{} { return 2 },
+		WithComparator(func(x, y interface{}) bool { return true }))
+
+	a.Run()
+	b.Run()
+
+	if len(published) != 2 || published[0].Name != "a" || published[1].Name != "b" {
+		t.Fatal("expected both experiments to use the template's publisher")
+	}
+	if !published[0].Matched {
+		t.Fatal("expected the template's comparator to be used")
+	}
+	if !published[1].Matched {
+		t.Fatal("expected options to override the template")
+	}
+
+	a.Comparator = nil
+	if c := tmpl.New("c", nil, nil); c.Comparator == nil {
+		t.Fatal("expected experiments not to share configuration")
+	}
+}
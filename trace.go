@@ -0,0 +1,186 @@
+package science
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// DefaultTraceLimit is the number of results a TraceRecorder keeps when
+// NewTraceRecorder is given a limit of zero.
+const DefaultTraceLimit = 10000
+
+// TraceRecorder collects the timing of experiment results and writes them in
+// the Chrome trace event format, which can be loaded into chrome://tracing or
+// Perfetto to see how the branches of many experiments overlap, for example
+// within a single request. Its Publish method can be used as the Publish
+// function of any number of experiments; to record alongside other
+// publishers, wrap it with ContextPublisher for MultiPublish.
+//
+// Each branch of each experiment is drawn on its own track, named after the
+// experiment and the branch, with one span per observation.
+type TraceRecorder struct {
+	limit int
+
+	mu      sync.Mutex
+	spans   []span
+	count   int // results recorded
+	dropped int64
+}
+
+// span is the part of an Observation a TraceRecorder keeps.
+type span struct {
+	experiment string
+	which      string
+	id         string
+	start, end time.Time
+	panicked   bool
+	matched    *bool
+}
+
+// NewTraceRecorder returns a TraceRecorder that keeps the first limit results
+// it is given. If limit is zero, DefaultTraceLimit is used.
+func NewTraceRecorder(limit int) *TraceRecorder {
+	if limit <= 0 {
+		limit = DefaultTraceLimit
+	}
+	return &TraceRecorder{limit: limit}
+}
+
+// Publish records the observations of the result. Partial results, and
+// observations that were not timed, such as the control of RunAgainstGolden,
+// are ignored. Once the recorder holds limit results, any more are dropped.
+func (t *TraceRecorder) Publish(r *Result) {
+	if r.Partial {
+		return
+	}
+
+	var matched *bool
+	if r.Compared {
+		m := r.Matched
+		matched = &m
+	}
+
+	var spans []span
+	add := func(o *Observation, matched *bool) {
+		if o == nil || o.Start.IsZero() {
+			return
+		}
+		spans = append(spans, span{
+			experiment: r.Name,
+			which:      o.Which,
+			id:         r.ID,
+			start:      o.Start,
+			end:        o.End,
+			panicked:   o.Panicked,
+			matched:    matched,
+		})
+	}
+	add(r.Control, nil)
+	add(r.Candidate, matched)
+	for _, name := range sortedNames(r.ExtraControls) {
+		var matched *bool
+		if m, ok := r.ExtraMatched[name]; ok {
+			matched = &m
+		}
+		add(r.ExtraControls[name], matched)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.count >= t.limit {
+		t.dropped++
+		return
+	}
+	t.spans = append(t.spans, spans...)
+	t.count++
+}
+
+// Dropped returns the number of results dropped because the recorder was
+// full.
+func (t *TraceRecorder) Dropped() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.dropped
+}
+
+// Reset discards every recorded result.
+func (t *TraceRecorder) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.spans = nil
+	t.count = 0
+	t.dropped = 0
+}
+
+// traceEvent is one event in the Chrome trace event format. Times are in
+// microseconds.
+type traceEvent struct {
+	Name string                 `json:"name"`
+	Cat  string                 `json:"cat,omitempty"`
+	Ph   string                 `json:"ph"`
+	Ts   float64                `json:"ts"`
+	Dur  float64                `json:"dur,omitempty"`
+	Pid  int                    `json:"pid"`
+	Tid  int                    `json:"tid"`
+	Args map[string]interface{} `json:"args,omitempty"`
+}
+
+// WriteTrace writes the recorded results to w as a Chrome trace JSON object.
+// Times are relative to the earliest recorded observation.
+func (t *TraceRecorder) WriteTrace(w io.Writer) error {
+	t.mu.Lock()
+	spans := append([]span(nil), t.spans...)
+	t.mu.Unlock()
+
+	var origin time.Time
+	for _, s := range spans {
+		if origin.IsZero() || s.start.Before(origin) {
+			origin = s.start
+		}
+	}
+	micros := func(d time.Duration) float64 { return float64(d) / float64(time.Microsecond) }
+
+	events := []traceEvent{}
+	tracks := make(map[string]int)
+	for _, s := range spans {
+		track := s.experiment + "/" + s.which
+		tid, ok := tracks[track]
+		if !ok {
+			tid = len(tracks) + 1
+			tracks[track] = tid
+			events = append(events, traceEvent{
+				Name: "thread_name",
+				Ph:   "M",
+				Pid:  1,
+				Tid:  tid,
+				Args: map[string]interface{}{"name": track},
+			})
+		}
+
+		args := map[string]interface{}{"id": s.id}
+		if s.panicked {
+			args["panicked"] = true
+		}
+		if s.matched != nil {
+			args["matched"] = *s.matched
+		}
+		events = append(events, traceEvent{
+			Name: s.experiment + " " + s.which,
+			Cat:  "science",
+			Ph:   "X",
+			Ts:   micros(s.start.Sub(origin)),
+			Dur:  micros(s.end.Sub(s.start)),
+			Pid:  1,
+			Tid:  tid,
+			Args: args,
+		})
+	}
+
+	return json.NewEncoder(w).Encode(struct {
+		TraceEvents     []traceEvent `json:"traceEvents"`
+		DisplayTimeUnit string       `json:"displayTimeUnit"`
+	}{events, "ms"})
+}
@@ -0,0 +1,67 @@
+package science
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestTraceRecorder(t *testing.T) {
+	tr := NewTraceRecorder(2)
+
+	e := NewExperiment("parse")
+	e.Publish = tr.Publish
+	e.Control = func() interface{} {
+		time.Sleep(time.Millisecond)
+		return 1
+	}
+	e.Candidate = func() interface{} { return 2 }
+	e.Run()
+	e.Run()
+	e.Run()
+
+	if tr.Dropped() != 1 {
+		t.Fatalf("expected the third result to be dropped, got %d", tr.Dropped())
+	}
+
+	tr.Publish(&Result{Name: "parse", Partial: true, Control: &Observation{Which: "control", Start: time.Now()}})
+
+	var buf bytes.Buffer
+	if err := tr.WriteTrace(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var trace struct {
+		TraceEvents []traceEvent `json:"traceEvents"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &trace); err != nil {
+		t.Fatalf("expected valid JSON, got %v: %s", err, buf.String())
+	}
+
+	var tracks, spans int
+	for _, ev := range trace.TraceEvents {
+		switch ev.Ph {
+		case "M":
+			tracks++
+		case "X":
+			spans++
+			if ev.Name == "parse control" && ev.Dur < 1000 {
+				t.Fatalf("expected the control span to last at least 1ms, got %vus", ev.Dur)
+			}
+			if ev.Name == "parse candidate" && ev.Args["matched"] != false {
+				t.Fatalf("expected the candidate span to record the mismatch, got %v", ev.Args)
+			}
+		}
+	}
+	if tracks != 2 || spans != 4 {
+		t.Fatalf("expected 2 tracks and 4 spans, got %d and %d", tracks, spans)
+	}
+
+	tr.Reset()
+	buf.Reset()
+	tr.WriteTrace(&buf)
+	if !bytes.Contains(buf.Bytes(), []byte(`"traceEvents":[]`)) {
+		t.Fatalf("expected an empty trace after Reset, got %s", buf.String())
+	}
+}
@@ -0,0 +1,28 @@
+package science
+
+// Wrap returns a function with the same signature as control which, each time
+// it is called, runs an experiment named name comparing control with
+// candidate and returns the control's value. This lets an experiment be
+// dropped into a call site by replacing f() with the wrapped function. If cmp
+// is nil, DefaultComparator is used.
+//
+// Any further configuration, such as Publish, can be applied with opts.
+func Wrap[T any](name string, control, candidate func() T, cmp func(T, T) bool, opts ...Option) func() T {
+	e := NewExperiment(name, opts...)
+	e.captureCaller(1)
+	e.Control = func() interface{} { return control() }
+	e.Candidate = func() interface{} { return candidate() }
+	if cmp != nil {
+		e.Comparator = func(a, b interface{}) bool {
+			x, _ := a.(T)
+			y, _ := b.(T)
+			return cmp(x, y)
+		}
+	}
+
+	return func() T {
+		v, _ := e.RunValue()
+		t, _ := v.(T)
+		return t
+	}
+}
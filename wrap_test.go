@@ -0,0 +1,29 @@
+package science
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWrap(t *testing.T) {
+	var result *Result
+	upper := Wrap("upper",
+		func() string { return strings.ToUpper("abc") },
+		func() string { return "abc" },
+		strings.EqualFold,
+		WithPublish(func(r *Result) { result = r }))
+
+	if got := upper(); got != "ABC" {
+		t.Fatalf("expected the control value, got %q", got)
+	}
+
+	if result == nil || !result.Matched {
+		t.Fatal("expected the typed comparator to be used")
+	}
+
+	var err error
+	failing := Wrap("err", func() error { return nil }, func() error { return err }, nil)
+	if failing() != nil {
+		t.Fatal("expected a nil interface value to be returned")
+	}
+}